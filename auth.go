@@ -0,0 +1,303 @@
+package test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// JWT signing algorithms
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// DefaultJWTExpiry is how long tokens minted by a JWTSigner are valid
+// when Expiry is not set
+const DefaultJWTExpiry = time.Hour
+
+// BasicAuth is the username and password of HTTP Basic authentication
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// JWTSigner mints signed JSON Web Tokens for requests to protected
+// endpoints
+type JWTSigner struct {
+	// Algorithm is JWTAlgorithmHS256, JWTAlgorithmRS256 or JWTAlgorithmEdDSA
+	Algorithm string
+
+	// Secret is the HS256 key
+	Secret []byte
+
+	// PrivateKey is the *rsa.PrivateKey for RS256 or the
+	// ed25519.PrivateKey for EdDSA
+	PrivateKey crypto.Signer
+
+	// KeyID sets the kid header, if not empty
+	KeyID string
+
+	// Issuer sets the iss claim, if not empty
+	Issuer string
+
+	// Audience sets the aud claim, if not empty
+	Audience string
+
+	// Expiry sets the exp claim relative to the issue time. Defaults to
+	// DefaultJWTExpiry, negative values mint already expired tokens.
+	Expiry time.Duration
+
+	// Clock sets the issue time. Defaults to the system time.
+	Clock *Clock
+}
+
+// NewHS256Signer returns a signer using HMAC SHA-256 with the secret
+func NewHS256Signer(secret []byte) *JWTSigner {
+	return &JWTSigner{Algorithm: JWTAlgorithmHS256, Secret: secret}
+}
+
+// NewRS256Signer returns a signer using RSA SHA-256 with a generated
+// 2048 bit key, see PublicKey for verifying its tokens
+func NewRS256Signer() (*JWTSigner, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+	}
+	return &JWTSigner{Algorithm: JWTAlgorithmRS256, PrivateKey: key}, nil
+}
+
+// NewEdDSASigner returns a signer using Ed25519 with a generated key, see
+// PublicKey for verifying its tokens
+func NewEdDSASigner() (*JWTSigner, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+	}
+	return &JWTSigner{Algorithm: JWTAlgorithmEdDSA, PrivateKey: key}, nil
+}
+
+// JWTSignerFromTestConfig returns a signer with a key derived from the
+// TestKey of the configuration, so the application under test can verify
+// the tokens with the same TestConfig. HS256 uses the TestKey as secret and
+// EdDSA its SHA-256 hash as seed. RS256 keys cannot be derived.
+func JWTSignerFromTestConfig(config *TestConfig, algorithm string) (*JWTSigner, error) {
+	key := TestKey(config.DbDriver, config.DbHost, config.DbPort, config.DbDatabase, config.DbUsername, config.DbPassword)
+
+	switch algorithm {
+	case JWTAlgorithmHS256:
+		return NewHS256Signer([]byte(key)), nil
+	case JWTAlgorithmEdDSA:
+		seed := sha256.Sum256([]byte(key))
+		return &JWTSigner{Algorithm: JWTAlgorithmEdDSA, PrivateKey: ed25519.NewKeyFromSeed(seed[:])}, nil
+	}
+
+	return nil, fmt.Errorf("cannot derive a %s key from the test configuration", algorithm)
+}
+
+// PublicKey returns the key verifying the tokens: the secret for HS256,
+// the *rsa.PublicKey for RS256 and the ed25519.PublicKey for EdDSA
+func (s *JWTSigner) PublicKey() crypto.PublicKey {
+	if s.Algorithm == JWTAlgorithmHS256 {
+		return s.Secret
+	}
+	if s.PrivateKey == nil {
+		return nil
+	}
+	return s.PrivateKey.Public()
+}
+
+// Sign mints a token with the claims. The iat and exp claims, and iss and
+// aud if configured, are added unless the claims set them.
+func (s *JWTSigner) Sign(claims map[string]any) (string, error) {
+	now := s.Clock.Now()
+
+	expiry := s.Expiry
+	if expiry == 0 {
+		expiry = DefaultJWTExpiry
+	}
+
+	payload := map[string]any{
+		"iat": now.Unix(),
+		"exp": now.Add(expiry).Unix(),
+	}
+	if s.Issuer != "" {
+		payload["iss"] = s.Issuer
+	}
+	if s.Audience != "" {
+		payload["aud"] = s.Audience
+	}
+	for key, value := range claims {
+		payload[key] = value
+	}
+
+	header := struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ"`
+		KeyID     string `json:"kid,omitempty"`
+	}{s.Algorithm, "JWT", s.KeyID}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT claims: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+
+	signature, err := s.signature(signingInput)
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// SignT is like Sign but fails the test on error
+func (s *JWTSigner) SignT(t testing.TB, claims map[string]any) string {
+	t.Helper()
+
+	token, err := s.Sign(claims)
+	if err != nil {
+		t.Fatalf("failed to sign JWT: %v", err)
+	}
+
+	return token
+}
+
+// Verify checks the signature and expiry of a token minted by the signer
+// and returns its claims
+func (s *JWTSigner) Verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+
+	header := struct {
+		Algorithm string `json:"alg"`
+	}{}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+	if header.Algorithm != s.Algorithm {
+		return nil, fmt.Errorf("JWT algorithm %s does not match %s", header.Algorithm, s.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT signature: %w", err)
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	if err := s.verifySignature(signingInput, signature); err != nil {
+		return nil, err
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT claims: %w", err)
+	}
+
+	claims := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(payloadJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("malformed JWT claims: %w", err)
+	}
+
+	if exp, ok := claims["exp"].(json.Number); ok {
+		expiresAt, err := exp.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("malformed JWT exp claim: %w", err)
+		}
+		if !s.Clock.Now().Before(time.Unix(expiresAt, 0)) {
+			return nil, errors.New("JWT is expired")
+		}
+	}
+
+	return claims, nil
+}
+
+// signature signs the encoded header and payload
+func (s *JWTSigner) signature(signingInput string) ([]byte, error) {
+	switch s.Algorithm {
+	case JWTAlgorithmHS256:
+		mac := hmac.New(sha256.New, s.Secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil), nil
+	case JWTAlgorithmRS256:
+		key, ok := s.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("RS256 requires an *rsa.PrivateKey")
+		}
+		hash := sha256.Sum256([]byte(signingInput))
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	case JWTAlgorithmEdDSA:
+		key, ok := s.PrivateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("EdDSA requires an ed25519.PrivateKey")
+		}
+		return ed25519.Sign(key, []byte(signingInput)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported JWT algorithm: %s", s.Algorithm)
+}
+
+// verifySignature checks the signature of the encoded header and payload
+func (s *JWTSigner) verifySignature(signingInput string, signature []byte) error {
+	switch s.Algorithm {
+	case JWTAlgorithmHS256:
+		expected, err := s.signature(signingInput)
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal(signature, expected) {
+			return errors.New("invalid JWT signature")
+		}
+		return nil
+	case JWTAlgorithmRS256:
+		publicKey := s.PublicKey()
+		key, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("RS256 requires an *rsa.PublicKey, got %T", publicKey)
+		}
+		hash := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+			return errors.New("invalid JWT signature")
+		}
+		return nil
+	case JWTAlgorithmEdDSA:
+		publicKey := s.PublicKey()
+		key, ok := publicKey.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("EdDSA requires an ed25519.PublicKey, got %T", publicKey)
+		}
+		if !ed25519.Verify(key, []byte(signingInput), signature) {
+			return errors.New("invalid JWT signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported JWT algorithm: %s", s.Algorithm)
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRequestBasicAuth(t *testing.T) {
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{
+		BasicAuth: &BasicAuth{Username: "admin", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	username, password, ok := req.BasicAuth()
+	if !ok || username != "admin" || password != "secret" {
+		t.Errorf("Expected basic auth admin/secret, got %q/%q (%t)", username, password, ok)
+	}
+}
+
+func TestNewRequestBearerToken(t *testing.T) {
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{BearerToken: "abc"})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("Expected Authorization %q, got %q", "Bearer abc", got)
+	}
+
+	// An Authorization header takes precedence
+	req, err = NewRequest(http.MethodGet, "/", NewRequestOptions{
+		BearerToken: "abc",
+		Headers:     map[string]string{"Authorization": "Token xyz"},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Token xyz" {
+		t.Errorf("Expected Authorization %q, got %q", "Token xyz", got)
+	}
+}
+
+func TestTestHTTPRequestAuth(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	})
+
+	recorder := NewTestHTTPRequest(http.MethodGet, "/").WithBasicAuth("admin", "secret").Execute(handler)
+	if recorder.Body.String() != "Basic YWRtaW46c2VjcmV0" {
+		t.Errorf("Expected basic credentials, got %q", recorder.Body.String())
+	}
+
+	recorder = NewTestHTTPRequest(http.MethodGet, "/").WithBearerToken("abc").Execute(handler)
+	if recorder.Body.String() != "Bearer abc" {
+		t.Errorf("Expected bearer token, got %q", recorder.Body.String())
+	}
+}
+
+func TestJWTSignerHS256(t *testing.T) {
+	clock := NewFrozenClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	signer := NewHS256Signer([]byte("secret"))
+	signer.Issuer = "tests"
+	signer.Clock = clock
+
+	token := signer.SignT(t, map[string]any{"sub": "42"})
+
+	header, _, _ := strings.Cut(token, ".")
+	if header != "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9" {
+		t.Errorf("Expected the standard HS256 header, got %q", header)
+	}
+
+	claims, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims["sub"] != "42" || claims["iss"] != "tests" {
+		t.Errorf("Expected sub and iss claims, got %v", claims)
+	}
+	if claims["exp"] != json.Number("1704070800") {
+		t.Errorf("Expected exp one hour after the clock, got %v", claims["exp"])
+	}
+
+	// Tokens expire with the clock
+	clock.Advance(2 * time.Hour)
+	if _, err := signer.Verify(token); err == nil {
+		t.Error("Expected the token to be expired")
+	}
+
+	// A different secret does not verify the token
+	if _, err := NewHS256Signer([]byte("other")).Verify(token); err == nil {
+		t.Error("Expected an invalid signature")
+	}
+}
+
+func TestJWTSignerExpired(t *testing.T) {
+	signer := NewHS256Signer([]byte("secret"))
+	signer.Expiry = -time.Minute
+
+	if _, err := signer.Verify(signer.SignT(t, nil)); err == nil {
+		t.Error("Expected an already expired token")
+	}
+}
+
+func TestJWTSignerRS256(t *testing.T) {
+	signer, err := NewRS256Signer()
+	if err != nil {
+		t.Fatalf("NewRS256Signer failed: %v", err)
+	}
+
+	token := signer.SignT(t, map[string]any{"role": "admin"})
+
+	claims, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims["role"] != "admin" {
+		t.Errorf("Expected role claim, got %v", claims)
+	}
+
+	// Tampered claims fail the signature check
+	parts := strings.Split(token, ".")
+	if _, err := signer.Verify(parts[0] + "." + parts[0] + "." + parts[2]); err == nil {
+		t.Error("Expected an invalid signature")
+	}
+}
+
+func TestJWTSignerWrongKey(t *testing.T) {
+	signer, err := NewRS256Signer()
+	if err != nil {
+		t.Fatalf("NewRS256Signer failed: %v", err)
+	}
+	token := signer.SignT(t, nil)
+
+	eddsa, err := NewEdDSASigner()
+	if err != nil {
+		t.Fatalf("NewEdDSASigner failed: %v", err)
+	}
+	signer.PrivateKey = eddsa.PrivateKey
+
+	_, err = signer.Verify(token)
+	if err == nil || !strings.Contains(err.Error(), "requires an *rsa.PublicKey, got ed25519.PublicKey") {
+		t.Errorf("Expected the public key type in the error, got %v", err)
+	}
+}
+
+func TestJWTSignerFromTestConfig(t *testing.T) {
+	config := DefaultTestConfig()
+
+	signer, err := JWTSignerFromTestConfig(config, JWTAlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("JWTSignerFromTestConfig failed: %v", err)
+	}
+	again, err := JWTSignerFromTestConfig(config, JWTAlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("JWTSignerFromTestConfig failed: %v", err)
+	}
+
+	// The key is derived, so the application can verify the tokens
+	if !signer.PublicKey().(ed25519.PublicKey).Equal(again.PublicKey()) {
+		t.Error("Expected the same key for the same configuration")
+	}
+	if _, err := again.Verify(signer.SignT(t, nil)); err != nil {
+		t.Errorf("Expected the token to verify, got %v", err)
+	}
+
+	hs256, err := JWTSignerFromTestConfig(config, JWTAlgorithmHS256)
+	if err != nil {
+		t.Fatalf("JWTSignerFromTestConfig failed: %v", err)
+	}
+	key := TestKey(config.DbDriver, config.DbHost, config.DbPort, config.DbDatabase, config.DbUsername, config.DbPassword)
+	if string(hs256.Secret) != key {
+		t.Errorf("Expected the TestKey as secret, got %q", hs256.Secret)
+	}
+
+	if _, err := JWTSignerFromTestConfig(config, JWTAlgorithmRS256); err == nil {
+		t.Error("Expected an error for RS256")
+	}
+}
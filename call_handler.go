@@ -3,15 +3,20 @@ package test
 import (
 	"net/http"
 	"net/http/httptest"
+	"testing"
 )
 
 func CallEndpoint(method string, f func(w http.ResponseWriter, r *http.Request), options NewRequestOptions) (body string, response *http.Response, err error) {
-	req, err := NewRequest(method, "/", options)
+	req, err := NewRequest(method, options.URL, options)
 
 	if err != nil {
 		return "", nil, err
 	}
 
+	// Release a streamed body the handler did not read, as servers do
+	defer req.Body.Close()
+	defer releaseRequest(req)
+
 	recorder := httptest.NewRecorder()
 	handler := http.HandlerFunc(f)
 	handler.ServeHTTP(recorder, req)
@@ -21,12 +26,16 @@ func CallEndpoint(method string, f func(w http.ResponseWriter, r *http.Request),
 }
 
 func CallStringEndpoint(method string, f func(w http.ResponseWriter, r *http.Request) string, options NewRequestOptions) (body string, response *http.Response, err error) {
-	req, err := NewRequest(method, "/", options)
+	req, err := NewRequest(method, options.URL, options)
 
 	if err != nil {
 		return "", nil, err
 	}
 
+	// Release a streamed body the handler did not read, as servers do
+	defer req.Body.Close()
+	defer releaseRequest(req)
+
 	recorder := httptest.NewRecorder()
 	handler := StringHandler(f)
 	handler.ServeHTTP(recorder, req)
@@ -35,6 +44,43 @@ func CallStringEndpoint(method string, f func(w http.ResponseWriter, r *http.Req
 	return body, recorder.Result(), nil
 }
 
+// CallEndpointT is like CallEndpoint but fails the test if the request
+// cannot be built, and logs the request as a curl command and a raw HTTP
+// dump if the test fails, see LogRequestOnFailure
+func CallEndpointT(t testing.TB, method string, f func(w http.ResponseWriter, r *http.Request), options NewRequestOptions) (body string, response *http.Response) {
+	t.Helper()
+	return callEndpointT(t, method, http.HandlerFunc(f), options)
+}
+
+// CallStringEndpointT is like CallStringEndpoint but fails the test if the
+// request cannot be built, and logs the request if the test fails
+func CallStringEndpointT(t testing.TB, method string, f func(w http.ResponseWriter, r *http.Request) string, options NewRequestOptions) (body string, response *http.Response) {
+	t.Helper()
+	return callEndpointT(t, method, StringHandler(f), options)
+}
+
+// callEndpointT serves the request built from the options, logging it if
+// the test fails
+func callEndpointT(t testing.TB, method string, handler http.Handler, options NewRequestOptions) (string, *http.Response) {
+	t.Helper()
+
+	req, err := NewRequest(method, options.URL, options)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+
+	// Release a streamed body the handler did not read, as servers do
+	defer req.Body.Close()
+	defer releaseRequest(req)
+
+	LogRequestOnFailure(t, req)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	return recorder.Body.String(), recorder.Result()
+}
+
 type StringHandler func(w http.ResponseWriter, r *http.Request) string
 
 func (h StringHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -2,6 +2,7 @@ package test
 
 import (
 	"net/http"
+	"net/url"
 	"testing"
 )
 
@@ -125,3 +126,36 @@ func TestStringHandler(t *testing.T) {
 		t.Errorf("Expected body %q, got %q", "Hello from StringHandler!", recorder.Body.String())
 	}
 }
+
+// TestCallEndpointURL tests calling handlers with a path, query and fragment
+func TestCallEndpointURL(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + r.URL.RawQuery + " " + r.URL.Fragment + " " + r.RequestURI))
+	}
+
+	body, _, err := CallEndpoint("GET", handler, NewRequestOptions{
+		URL:         "/users/42?tab=posts&page=1#top",
+		QueryParams: url.Values{"page": {"2"}, "sort": {"new"}},
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	expected := "/users/42 page=2&sort=new&tab=posts top /users/42?page=2&sort=new&tab=posts"
+	if body != expected {
+		t.Errorf("Expected body %q, got %q", expected, body)
+	}
+
+	// The query of the URL is kept as is without QueryParams
+	body, _, err = CallStringEndpoint("GET", func(w http.ResponseWriter, r *http.Request) string {
+		return r.URL.RawQuery
+	}, NewRequestOptions{
+		URL: "/search?q=a+b&z=1&a=2",
+	})
+	if err != nil {
+		t.Fatalf("CallStringEndpoint failed: %v", err)
+	}
+	if body != "q=a+b&z=1&a=2" {
+		t.Errorf("Expected query %q, got %q", "q=a+b&z=1&a=2", body)
+	}
+}
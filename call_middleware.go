@@ -6,12 +6,16 @@ import (
 )
 
 func CallMiddleware(method string, middleware func(next http.Handler) http.Handler, next func(w http.ResponseWriter, r *http.Request), options NewRequestOptions) (body string, response *http.Response, err error) {
-	req, err := NewRequest(method, "/", options)
+	req, err := NewRequest(method, options.URL, options)
 
 	if err != nil {
 		return "", nil, err
 	}
 
+	// Release a streamed body the handler did not read, as servers do
+	defer req.Body.Close()
+	defer releaseRequest(req)
+
 	recorder := httptest.NewRecorder()
 	handler := middleware(http.HandlerFunc(next))
 	handler.ServeHTTP(recorder, req)
@@ -2,6 +2,7 @@ package test_test
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/dracory/test"
@@ -58,3 +59,39 @@ func TestCallMiddleware(t *testing.T) {
 		t.Errorf("Expected body %q, got %q", "Middleware test", body)
 	}
 }
+
+// TestCallMiddlewareURL tests middleware matching path prefixes
+func TestCallMiddlewareURL(t *testing.T) {
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/admin/") {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+
+	_, resp, err := test.CallMiddleware("GET", middleware, handler, test.NewRequestOptions{
+		URL: "/admin/users",
+	})
+	if err != nil {
+		t.Fatalf("CallMiddleware failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	body, resp, err := test.CallMiddleware("GET", middleware, handler, test.NewRequestOptions{
+		URL: "/public",
+	})
+	if err != nil {
+		t.Fatalf("CallMiddleware failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || body != "ok" {
+		t.Errorf("Expected status code %d and body %q, got %d and %q", http.StatusOK, "ok", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,491 @@
+package test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// changeLogTable prefixes the shadow tables the SQLite capture triggers
+// write to, each capture uses its own
+const changeLogTable = "_dracory_changes"
+
+// ChangeKind is the kind of change made to a row
+type ChangeKind string
+
+const (
+	ChangeInsert ChangeKind = "insert"
+	ChangeUpdate ChangeKind = "update"
+	ChangeDelete ChangeKind = "delete"
+)
+
+// RowChange is a single row inserted, updated or deleted. Before is nil for
+// inserts and After is nil for deletes.
+type RowChange struct {
+	Kind   ChangeKind
+	Before map[string]any
+	After  map[string]any
+}
+
+// TableChanges holds the rows of one table changed during a capture
+type TableChanges struct {
+	Table    string
+	Inserted []RowChange
+	Updated  []RowChange
+	Deleted  []RowChange
+}
+
+// Empty reports whether no rows of the table were changed
+func (tc *TableChanges) Empty() bool {
+	return len(tc.Inserted) == 0 && len(tc.Updated) == 0 && len(tc.Deleted) == 0
+}
+
+// Changeset holds the rows changed during CaptureChanges, per table
+type Changeset struct {
+	// Tables holds the changed tables, sorted by name
+	Tables []*TableChanges
+}
+
+// ChangeCaptureOptions configures CaptureChanges
+type ChangeCaptureOptions struct {
+	// Tables limits the capture to these tables. Defaults to all tables.
+	Tables []string
+
+	// Exclude lists tables to ignore, e.g. migration bookkeeping
+	Exclude []string
+
+	// Snapshots forces the portable snapshot diff even on SQLite
+	Snapshots bool
+}
+
+// CaptureChanges runs fn and returns the rows it inserted, updated and
+// deleted, per table. On SQLite, triggers on every captured table write
+// each change to a shadow log, so every statement is recorded in order
+// (BLOB values are recorded as hex strings). On other databases, or with
+// Snapshots set, every captured table is read before and after fn and the
+// snapshots are diffed by primary key, so only the net effect is recorded
+// and tables without a primary key report updates as a delete and an
+// insert. Tables created by fn are not captured.
+//
+// The changeset is returned along with the error of fn, if any.
+func CaptureChanges(db *sql.DB, opts *ChangeCaptureOptions, fn func() error) (*Changeset, error) {
+	if opts == nil {
+		opts = &ChangeCaptureOptions{}
+	}
+
+	tables, err := captureTables(db, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if DialectForDB(db).Name() == DialectSQLite && !opts.Snapshots {
+		return captureWithTriggers(db, tables, fn)
+	}
+
+	return captureWithSnapshots(db, tables, fn)
+}
+
+// Table returns the changes of a table, empty if it was not changed
+func (c *Changeset) Table(name string) *TableChanges {
+	for _, tc := range c.Tables {
+		if tc.Table == name {
+			return tc
+		}
+	}
+	return &TableChanges{Table: name}
+}
+
+// Empty reports whether no rows were changed
+func (c *Changeset) Empty() bool {
+	return len(c.Tables) == 0
+}
+
+// String renders a summary of the changeset, one line per table followed
+// by one line per changed row
+func (c *Changeset) String() string {
+	if c.Empty() {
+		return "no changes"
+	}
+
+	var b strings.Builder
+	for _, tc := range c.Tables {
+		fmt.Fprintf(&b, "%s: %d inserted, %d updated, %d deleted\n", tc.Table, len(tc.Inserted), len(tc.Updated), len(tc.Deleted))
+		for _, change := range tc.Inserted {
+			b.WriteString("  + " + formatRow(change.After) + "\n")
+		}
+		for _, change := range tc.Updated {
+			b.WriteString("  ~ " + formatRowUpdate(change.Before, change.After) + "\n")
+		}
+		for _, change := range tc.Deleted {
+			b.WriteString("  - " + formatRow(change.Before) + "\n")
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// AssertInserted fails the test unless exactly n rows were inserted into the table
+func (c *Changeset) AssertInserted(t testing.TB, table string, n int) {
+	t.Helper()
+	if got := len(c.Table(table).Inserted); got != n {
+		t.Errorf("Expected %d rows inserted into %s, got %d\n%s", n, table, got, c)
+	}
+}
+
+// AssertUpdated fails the test unless exactly n rows of the table were updated
+func (c *Changeset) AssertUpdated(t testing.TB, table string, n int) {
+	t.Helper()
+	if got := len(c.Table(table).Updated); got != n {
+		t.Errorf("Expected %d rows updated in %s, got %d\n%s", n, table, got, c)
+	}
+}
+
+// AssertDeleted fails the test unless exactly n rows were deleted from the table
+func (c *Changeset) AssertDeleted(t testing.TB, table string, n int) {
+	t.Helper()
+	if got := len(c.Table(table).Deleted); got != n {
+		t.Errorf("Expected %d rows deleted from %s, got %d\n%s", n, table, got, c)
+	}
+}
+
+// AssertOnlyChanged fails the test if any table other than the given ones
+// was changed. Without tables it asserts that nothing was changed.
+func (c *Changeset) AssertOnlyChanged(t testing.TB, tables ...string) {
+	t.Helper()
+
+	unexpected := []string{}
+	for _, tc := range c.Tables {
+		if !slices.Contains(tables, tc.Table) {
+			unexpected = append(unexpected, tc.Table)
+		}
+	}
+
+	if len(unexpected) > 0 {
+		t.Errorf("Expected only %v to change, but %v changed too\n%s", tables, unexpected, c)
+	}
+}
+
+// add records a change for a table
+func (c *Changeset) add(table string, change RowChange) {
+	var tc *TableChanges
+	for _, existing := range c.Tables {
+		if existing.Table == table {
+			tc = existing
+		}
+	}
+
+	if tc == nil {
+		tc = &TableChanges{Table: table}
+		c.Tables = append(c.Tables, tc)
+		sort.Slice(c.Tables, func(i, j int) bool { return c.Tables[i].Table < c.Tables[j].Table })
+	}
+
+	switch change.Kind {
+	case ChangeInsert:
+		tc.Inserted = append(tc.Inserted, change)
+	case ChangeUpdate:
+		tc.Updated = append(tc.Updated, change)
+	case ChangeDelete:
+		tc.Deleted = append(tc.Deleted, change)
+	}
+}
+
+// captureTables returns the tables to capture for the options
+func captureTables(db *sql.DB, opts *ChangeCaptureOptions) ([]string, error) {
+	tables := opts.Tables
+	if len(tables) == 0 {
+		all, err := tableNames(db)
+		if err != nil {
+			return nil, err
+		}
+		tables = all
+	}
+
+	result := []string{}
+	for _, table := range tables {
+		if !strings.HasPrefix(table, changeLogTable) && !slices.Contains(opts.Exclude, table) {
+			result = append(result, table)
+		}
+	}
+
+	return result, nil
+}
+
+// captureWithTriggers records changes through SQLite triggers writing to
+// a shadow log table. The triggers are regular (not TEMP) triggers so
+// they fire on every connection of the pool. The log table and triggers
+// get a random suffix, so concurrent captures on a shared database keep
+// their own.
+func captureWithTriggers(db *sql.DB, tables []string, fn func() error) (changes *Changeset, err error) {
+	dialect := DialectForDB(db)
+	suffix := randomHex(4)
+	logTable := dialect.QuoteIdentifier(changeLogTable + "_" + suffix)
+	sqlString := func(value string) string {
+		quoted, _ := quoteLiteral(DialectSQLite, value)
+		return quoted
+	}
+
+	triggers := []string{}
+	defer func() {
+		cleanup := []error{}
+		for _, trigger := range triggers {
+			cleanup = append(cleanup, ExecuteSQL(db, "DROP TRIGGER IF EXISTS "+dialect.QuoteIdentifier(trigger)))
+		}
+		cleanup = append(cleanup, ExecuteSQL(db, "DROP TABLE IF EXISTS "+logTable))
+		if cleanupErr := errors.Join(cleanup...); cleanupErr != nil && err == nil {
+			changes, err = nil, fmt.Errorf("failed to remove change capture triggers: %w", cleanupErr)
+		}
+	}()
+
+	if err := ExecuteSQL(db, "CREATE TABLE "+logTable+" (id INTEGER PRIMARY KEY, table_name TEXT, kind TEXT, old_row TEXT, new_row TEXT)"); err != nil {
+		return nil, fmt.Errorf("failed to create change log: %w", err)
+	}
+
+	for _, table := range tables {
+		columns, err := tableColumnNames(db, table)
+		if err != nil {
+			return nil, err
+		}
+
+		rowJSON := func(alias string) string {
+			pairs := make([]string, len(columns))
+			for i, column := range columns {
+				value := alias + "." + dialect.QuoteIdentifier(column)
+				pairs[i] = fmt.Sprintf("%s, CASE WHEN typeof(%s) = 'blob' THEN hex(%s) ELSE %s END", sqlString(column), value, value, value)
+			}
+			return "json_object(" + strings.Join(pairs, ", ") + ")"
+		}
+
+		for _, kind := range []ChangeKind{ChangeInsert, ChangeUpdate, ChangeDelete} {
+			oldRow, newRow := "NULL", "NULL"
+			if kind != ChangeInsert {
+				oldRow = rowJSON("OLD")
+			}
+			if kind != ChangeDelete {
+				newRow = rowJSON("NEW")
+			}
+
+			trigger := fmt.Sprintf("_dracory_capture_%s_%s_%s", table, kind, suffix)
+			statement := fmt.Sprintf("CREATE TRIGGER %s AFTER %s ON %s BEGIN INSERT INTO %s (table_name, kind, old_row, new_row) VALUES (%s, '%s', %s, %s); END",
+				dialect.QuoteIdentifier(trigger), strings.ToUpper(string(kind)), dialect.QuoteIdentifier(table), logTable,
+				sqlString(table), kind, oldRow, newRow)
+
+			if err := ExecuteSQL(db, statement); err != nil {
+				return nil, fmt.Errorf("failed to create change capture trigger on %s: %w", table, err)
+			}
+			triggers = append(triggers, trigger)
+		}
+	}
+
+	fnErr := fn()
+
+	rows, err := db.Query("SELECT table_name, kind, old_row, new_row FROM " + logTable + " ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change log: %w", err)
+	}
+	defer rows.Close()
+
+	changes = &Changeset{}
+	for rows.Next() {
+		var table, kind string
+		var oldRow, newRow sql.NullString
+		if err := rows.Scan(&table, &kind, &oldRow, &newRow); err != nil {
+			return nil, fmt.Errorf("failed to read change log: %w", err)
+		}
+
+		change := RowChange{Kind: ChangeKind(kind)}
+		if change.Before, err = decodeLoggedRow(oldRow); err != nil {
+			return nil, err
+		}
+		if change.After, err = decodeLoggedRow(newRow); err != nil {
+			return nil, err
+		}
+
+		changes.add(table, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read change log: %w", err)
+	}
+
+	return changes, fnErr
+}
+
+// decodeLoggedRow decodes a row logged as a JSON object, returning integers
+// as int64 and other numbers as float64 like the SQLite driver does
+func decodeLoggedRow(value sql.NullString) (map[string]any, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value.String)))
+	decoder.UseNumber()
+
+	row := map[string]any{}
+	if err := decoder.Decode(&row); err != nil {
+		return nil, fmt.Errorf("failed to decode logged row: %w", err)
+	}
+
+	for column, v := range row {
+		if number, ok := v.(json.Number); ok {
+			if i, err := number.Int64(); err == nil {
+				row[column] = i
+			} else {
+				row[column], _ = number.Float64()
+			}
+		}
+	}
+
+	return row, nil
+}
+
+// tableSnapshot holds every row of a table and its primary key columns
+type tableSnapshot struct {
+	primaryKey []string
+	rows       []map[string]any
+}
+
+// captureWithSnapshots records the net changes by diffing the captured
+// tables before and after fn
+func captureWithSnapshots(db *sql.DB, tables []string, fn func() error) (*Changeset, error) {
+	before := map[string]tableSnapshot{}
+	for _, table := range tables {
+		snapshot, err := takeSnapshot(db, table)
+		if err != nil {
+			return nil, err
+		}
+		before[table] = snapshot
+	}
+
+	fnErr := fn()
+
+	changes := &Changeset{}
+	for _, table := range tables {
+		after, err := takeSnapshot(db, table)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, change := range diffSnapshots(before[table], after) {
+			changes.add(table, change)
+		}
+	}
+
+	return changes, fnErr
+}
+
+// takeSnapshot reads every row of a table, ordered by primary key
+func takeSnapshot(db *sql.DB, table string) (tableSnapshot, error) {
+	dialect := DialectForDB(db)
+
+	primaryKey, err := primaryKeyColumns(db, table)
+	if err != nil {
+		return tableSnapshot{}, err
+	}
+
+	query := "SELECT * FROM " + dialect.QuoteIdentifier(table)
+	if len(primaryKey) > 0 {
+		query += " ORDER BY " + quoteIdentifiers(dialect.Name(), primaryKey)
+	}
+
+	rows, err := QueryMaps(db, query)
+	if err != nil {
+		return tableSnapshot{}, err
+	}
+
+	return tableSnapshot{primaryKey: primaryKey, rows: rows}, nil
+}
+
+// diffSnapshots compares two snapshots of a table. Rows are matched by
+// primary key, or by their full contents if the table has none.
+func diffSnapshots(before tableSnapshot, after tableSnapshot) []RowChange {
+	keyColumns := after.primaryKey
+	if len(keyColumns) == 0 && len(after.rows) > 0 {
+		for column := range after.rows[0] {
+			keyColumns = append(keyColumns, column)
+		}
+		sort.Strings(keyColumns)
+	}
+
+	rowKey := func(row map[string]any) string {
+		values := make([]string, len(keyColumns))
+		for i, column := range keyColumns {
+			values[i] = fmt.Sprintf("%#v", row[column])
+		}
+		return strings.Join(values, "\x00")
+	}
+
+	// Rows without a primary key may repeat, so each key holds a queue
+	remaining := map[string][]map[string]any{}
+	for _, row := range before.rows {
+		key := rowKey(row)
+		remaining[key] = append(remaining[key], row)
+	}
+
+	changes := []RowChange{}
+	for _, row := range after.rows {
+		key := rowKey(row)
+		if len(remaining[key]) == 0 {
+			changes = append(changes, RowChange{Kind: ChangeInsert, After: row})
+			continue
+		}
+
+		old := remaining[key][0]
+		remaining[key] = remaining[key][1:]
+		if !reflect.DeepEqual(old, row) {
+			changes = append(changes, RowChange{Kind: ChangeUpdate, Before: old, After: row})
+		}
+	}
+
+	for _, row := range before.rows {
+		key := rowKey(row)
+		if len(remaining[key]) > 0 && reflect.DeepEqual(remaining[key][0], row) {
+			remaining[key] = remaining[key][1:]
+			changes = append(changes, RowChange{Kind: ChangeDelete, Before: row})
+		}
+	}
+
+	return changes
+}
+
+// formatRow renders a row as {column: value, ...} with sorted columns
+func formatRow(row map[string]any) string {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	pairs := make([]string, len(columns))
+	for i, column := range columns {
+		pairs[i] = column + ": " + formatCell(row[column])
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// formatRowUpdate renders the columns changed by an update as
+// {column: old -> new, ...}
+func formatRowUpdate(before map[string]any, after map[string]any) string {
+	columns := make([]string, 0, len(after))
+	for column := range after {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	pairs := []string{}
+	for _, column := range columns {
+		if !reflect.DeepEqual(before[column], after[column]) {
+			pairs = append(pairs, column+": "+formatCell(before[column])+" -> "+formatCell(after[column]))
+		}
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newChangesTestDB(t *testing.T, name string) *sql.DB {
+	db := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:" + name + "?mode=memory&cache=shared"})
+
+	for _, statement := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, avatar BLOB)",
+		"CREATE TABLE audit_log (message TEXT)",
+		"CREATE TABLE settings (key TEXT PRIMARY KEY, value TEXT)",
+		"INSERT INTO users (id, name) VALUES (1, 'alice'), (2, 'bob')",
+		"INSERT INTO settings (key, value) VALUES ('theme', 'dark')",
+	} {
+		if err := ExecuteSQL(db, statement); err != nil {
+			t.Fatalf("Failed to set up tables: %v", err)
+		}
+	}
+
+	return db
+}
+
+// execAll executes the statements, stopping at the first error
+func execAll(db *sql.DB, statements ...string) error {
+	for _, statement := range statements {
+		if err := ExecuteSQL(db, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestCaptureChanges(t *testing.T) {
+	for _, snapshots := range []bool{false, true} {
+		name := "triggers"
+		if snapshots {
+			name = "snapshots"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			db := newChangesTestDB(t, "capture_changes_"+name)
+
+			changes, err := CaptureChanges(db, &ChangeCaptureOptions{Snapshots: snapshots}, func() error {
+				return execAll(db,
+					"INSERT INTO users (id, name, avatar) VALUES (3, 'carol', x'CAFE')",
+					"INSERT INTO audit_log (message) VALUES ('created carol')",
+					"UPDATE users SET name = 'robert' WHERE id = 2",
+					"DELETE FROM users WHERE id = 1",
+				)
+			})
+			if err != nil {
+				t.Fatalf("CaptureChanges failed: %v", err)
+			}
+
+			changes.AssertInserted(t, "users", 1)
+			changes.AssertUpdated(t, "users", 1)
+			changes.AssertDeleted(t, "users", 1)
+			changes.AssertInserted(t, "audit_log", 1)
+			changes.AssertOnlyChanged(t, "users", "audit_log")
+
+			updated := changes.Table("users").Updated[0]
+			if updated.Before["name"] != "bob" || updated.After["name"] != "robert" {
+				t.Errorf("Expected bob to be renamed to robert, got %v -> %v", updated.Before, updated.After)
+			}
+
+			if id := changes.Table("users").Inserted[0].After["id"]; id != int64(3) {
+				t.Errorf("Expected inserted id 3, got %#v", id)
+			}
+
+			summary := changes.String()
+			if !strings.Contains(summary, "users: 1 inserted, 1 updated, 1 deleted") || !strings.Contains(summary, "name: bob -> robert") {
+				t.Errorf("Unexpected summary:\n%s", summary)
+			}
+
+			tables, err := tableNames(db)
+			if err != nil {
+				t.Fatalf("Failed to list tables: %v", err)
+			}
+			if strings.Join(tables, ",") != "audit_log,settings,users" {
+				t.Errorf("Expected the capture to clean up after itself, got tables %v", tables)
+			}
+		})
+	}
+}
+
+func TestCaptureChangesOptions(t *testing.T) {
+	db := newChangesTestDB(t, "capture_changes_options")
+
+	fnErr := errors.New("handler failed")
+	changes, err := CaptureChanges(db, &ChangeCaptureOptions{Exclude: []string{"audit_log"}}, func() error {
+		if err := ExecuteSQL(db, "INSERT INTO audit_log (message) VALUES ('ignored')"); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Errorf("Expected the error of fn, got %v", err)
+	}
+	if changes == nil || !changes.Empty() {
+		t.Errorf("Expected no changes for excluded tables, got %v", changes)
+	}
+	if changes.String() != "no changes" {
+		t.Errorf("Expected an empty summary, got %q", changes.String())
+	}
+}
+
+func TestCaptureChangesConcurrent(t *testing.T) {
+	db := newChangesTestDB(t, "capture_changes_concurrent")
+
+	var inner *Changeset
+	outer, err := CaptureChanges(db, &ChangeCaptureOptions{Tables: []string{"users"}}, func() error {
+		if err := ExecuteSQL(db, "INSERT INTO users (id, name) VALUES (3, 'carol')"); err != nil {
+			return err
+		}
+
+		// A second capture on the same database keeps its own log
+		var err error
+		inner, err = CaptureChanges(db, &ChangeCaptureOptions{Tables: []string{"settings"}}, func() error {
+			return execAll(db,
+				"UPDATE settings SET value = 'light' WHERE key = 'theme'",
+				"INSERT INTO users (id, name) VALUES (4, 'dave')",
+			)
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("CaptureChanges failed: %v", err)
+	}
+
+	outer.AssertInserted(t, "users", 2)
+	outer.AssertOnlyChanged(t, "users")
+	inner.AssertUpdated(t, "settings", 1)
+	inner.AssertOnlyChanged(t, "settings")
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is a controllable source of "now" for tests. A new clock follows
+// the system time until it is frozen, set or advanced. A nil *Clock reads
+// the system time, so code can call ClockFromContext(ctx).Now() without
+// checking for a clock.
+//
+// SQLite test databases use the clock set with sqlitecompat.SetClock for
+// NOW() and the other emulated current date functions, and handlers
+// receive it through the request context with NewRequestOptions.Clock.
+type Clock struct {
+	mu     sync.Mutex
+	frozen bool
+	now    time.Time     // the frozen time
+	offset time.Duration // added to the system time while running
+}
+
+// clockContextKey is the context key the request clock is stored under
+type clockContextKey struct{}
+
+// NewClock returns a clock following the system time
+func NewClock() *Clock {
+	return &Clock{}
+}
+
+// NewFrozenClock returns a clock frozen at the given time
+func NewFrozenClock(t time.Time) *Clock {
+	return &Clock{frozen: true, now: t}
+}
+
+// Now returns the current time of the clock
+func (c *Clock) Now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.frozen {
+		return c.now
+	}
+	return time.Now().Add(c.offset)
+}
+
+// Freeze stops the clock at its current time and returns that time
+func (c *Clock) Freeze() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.frozen {
+		c.now = time.Now().Add(c.offset)
+		c.frozen = true
+	}
+	return c.now
+}
+
+// Set freezes the clock at the given time
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+	c.frozen = true
+}
+
+// Advance moves the clock forward (or backward, for a negative duration)
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.frozen {
+		c.now = c.now.Add(d)
+	} else {
+		c.offset += d
+	}
+}
+
+// Unfreeze lets the clock run again from the time it was frozen at
+func (c *Clock) Unfreeze() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.frozen {
+		c.offset = time.Until(c.now)
+		c.frozen = false
+	}
+}
+
+// ContextWithClock returns a copy of the context carrying the clock
+func ContextWithClock(ctx context.Context, clock *Clock) context.Context {
+	return context.WithValue(ctx, clockContextKey{}, clock)
+}
+
+// ClockFromContext returns the clock carried by the context, or nil (which
+// reads the system time) if there is none
+func ClockFromContext(ctx context.Context) *Clock {
+	clock, _ := ctx.Value(clockContextKey{}).(*Clock)
+	return clock
+}
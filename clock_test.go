@@ -0,0 +1,51 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+
+	clock := NewFrozenClock(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("Expected %v, got %v", start, clock.Now())
+	}
+
+	clock.Advance(time.Hour)
+	if !clock.Now().Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected the clock to advance by an hour, got %v", clock.Now())
+	}
+
+	clock.Unfreeze()
+	if elapsed := clock.Now().Sub(start.Add(time.Hour)); elapsed < 0 || elapsed > time.Second {
+		t.Errorf("Expected the clock to run from the frozen time, got %v", clock.Now())
+	}
+
+	frozen := clock.Freeze()
+	time.Sleep(time.Millisecond)
+	if !clock.Now().Equal(frozen) {
+		t.Errorf("Expected the clock to stay frozen at %v, got %v", frozen, clock.Now())
+	}
+
+	var system *Clock
+	if time.Since(system.Now()) > time.Second {
+		t.Errorf("Expected a nil clock to read the system time")
+	}
+}
+
+func TestClockRequestContext(t *testing.T) {
+	clock := NewFrozenClock(time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))
+
+	body, _, err := CallStringEndpoint(http.MethodGet, func(w http.ResponseWriter, r *http.Request) string {
+		return ClockFromContext(r.Context()).Now().Format(time.DateOnly)
+	}, NewRequestOptions{Clock: clock})
+	if err != nil {
+		t.Fatalf("CallStringEndpoint failed: %v", err)
+	}
+	if body != "2024-03-05" {
+		t.Errorf("Expected the handler to read the clock, got %q", body)
+	}
+}
@@ -0,0 +1,247 @@
+package test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultRemotePort is the port of remote addresses given without one,
+// matching httptest.DefaultRemoteAddr
+const defaultRemotePort = "1234"
+
+// Proxy header styles of a ProxyChain
+const (
+	// ProxyHeadersXForwarded adds X-Forwarded-For, X-Forwarded-Proto and
+	// X-Forwarded-Host
+	ProxyHeadersXForwarded = "x-forwarded"
+
+	// ProxyHeadersForwarded adds the RFC 7239 Forwarded header
+	ProxyHeadersForwarded = "forwarded"
+
+	// ProxyHeadersBoth adds both styles
+	ProxyHeadersBoth = "both"
+)
+
+// ProxyChain simulates a request from a client passing through proxies:
+// each proxy appends the address it received the request from, and the
+// last one connects to the server, becoming the RemoteAddr
+type ProxyChain struct {
+	// ClientIP is the IP of the original client
+	ClientIP string
+
+	// Proxies are the IPs of the proxies in the order the request passed
+	// through them, at least one
+	Proxies []string
+
+	// Proto is the scheme the client used (e.g. "https" for TLS
+	// terminated at the first proxy), left out if empty
+	Proto string
+
+	// Host is the host the client requested, left out if empty
+	Host string
+
+	// Headers is ProxyHeadersXForwarded (default), ProxyHeadersForwarded
+	// or ProxyHeadersBoth
+	Headers string
+}
+
+// validate checks the addresses and the headers style of the chain
+func (p *ProxyChain) validate() error {
+	if len(p.Proxies) == 0 {
+		return fmt.Errorf("proxy chain needs at least one proxy")
+	}
+
+	for _, address := range append([]string{p.ClientIP}, p.Proxies...) {
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("invalid proxy chain IP %q", address)
+		}
+	}
+
+	switch p.Headers {
+	case "", ProxyHeadersXForwarded, ProxyHeadersForwarded, ProxyHeadersBoth:
+		return nil
+	}
+
+	return fmt.Errorf("unknown proxy headers style %q", p.Headers)
+}
+
+// apply adds the proxy headers and sets the RemoteAddr to the last proxy.
+// The chain must have been checked with validate.
+func (p *ProxyChain) apply(req *http.Request) {
+	// Each proxy records the address it received the request from
+	addresses := append([]string{p.ClientIP}, p.Proxies[:len(p.Proxies)-1]...)
+
+	style := p.Headers
+	if style == "" {
+		style = ProxyHeadersXForwarded
+	}
+
+	if style == ProxyHeadersXForwarded || style == ProxyHeadersBoth {
+		req.Header.Set("X-Forwarded-For", strings.Join(addresses, ", "))
+		if p.Proto != "" {
+			req.Header.Set("X-Forwarded-Proto", p.Proto)
+		}
+		if p.Host != "" {
+			req.Header.Set("X-Forwarded-Host", p.Host)
+		}
+	}
+
+	if style == ProxyHeadersForwarded || style == ProxyHeadersBoth {
+		elements := []string{}
+		for i, address := range addresses {
+			element := "for=" + forwardedNode(address)
+			// The first proxy records what the client asked for
+			if i == 0 && p.Proto != "" {
+				element += ";proto=" + p.Proto
+			}
+			if i == 0 && p.Host != "" {
+				element += ";host=" + forwardedValue(p.Host)
+			}
+			elements = append(elements, element)
+		}
+		req.Header.Set("Forwarded", strings.Join(elements, ", "))
+	}
+
+	req.RemoteAddr = net.JoinHostPort(p.Proxies[len(p.Proxies)-1], defaultRemotePort)
+}
+
+// forwardedNode formats an IP as a Forwarded node, quoting IPv6 addresses
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+// forwardedValue quotes a Forwarded value if it is not a token
+func forwardedValue(value string) string {
+	if strings.ContainsAny(value, `:[]"(),/;<=>?@\{} `) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
+
+// NewTLSConnectionState returns the state of a completed TLS 1.3
+// handshake for serverName, for requests simulating HTTPS. Client
+// certificates simulate mutual TLS: they are the peer certificates and,
+// as if verified, the verified chain.
+func NewTLSConnectionState(serverName string, clientCertificates ...*x509.Certificate) *tls.ConnectionState {
+	state := &tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		HandshakeComplete:  true,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "http/1.1",
+		ServerName:         serverName,
+	}
+
+	if len(clientCertificates) > 0 {
+		state.PeerCertificates = clientCertificates
+		state.VerifiedChains = [][]*x509.Certificate{clientCertificates}
+	}
+
+	return state
+}
+
+// NewTestCertificate returns a self-signed certificate for commonName,
+// valid for a day, to use as a client certificate with
+// NewTLSConnectionState
+func NewTestCertificate(commonName string) (*x509.Certificate, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// connection holds the connection properties of a request
+type connection struct {
+	remoteAddr string
+	host       string
+	proto      string
+	tls        *tls.ConnectionState
+	proxy      *ProxyChain
+}
+
+// validate checks the connection properties, so invalid ones are reported
+// before the request body is built
+func (c connection) validate() error {
+	if c.proxy != nil {
+		if err := c.proxy.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.remoteAddr != "" {
+		if _, _, err := net.SplitHostPort(c.remoteAddr); err != nil && net.ParseIP(c.remoteAddr) == nil {
+			return fmt.Errorf("invalid remote address %q", c.remoteAddr)
+		}
+	}
+
+	if c.proto != "" {
+		if _, _, ok := http.ParseHTTPVersion(c.proto); !ok {
+			return fmt.Errorf("invalid protocol version %q", c.proto)
+		}
+	}
+
+	return nil
+}
+
+// apply sets the connection properties of the request. They must have been
+// checked with validate.
+func (c connection) apply(req *http.Request) {
+	if c.proxy != nil {
+		c.proxy.apply(req)
+	}
+
+	// An explicit remote address takes precedence over the proxy
+	if c.remoteAddr != "" {
+		if _, _, err := net.SplitHostPort(c.remoteAddr); err != nil {
+			req.RemoteAddr = net.JoinHostPort(c.remoteAddr, defaultRemotePort)
+		} else {
+			req.RemoteAddr = c.remoteAddr
+		}
+	}
+
+	if c.host != "" {
+		req.Host = c.host
+	}
+
+	if c.proto != "" {
+		major, minor, _ := http.ParseHTTPVersion(c.proto)
+		req.Proto, req.ProtoMajor, req.ProtoMinor = c.proto, major, minor
+	}
+
+	if c.tls != nil {
+		req.TLS = c.tls
+	}
+}
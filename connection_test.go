@@ -0,0 +1,167 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewRequestConnection(t *testing.T) {
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{
+		RemoteAddr: "203.0.113.7",
+		Host:       "shop.example.com",
+		Proto:      "HTTP/2.0",
+		TLS:        NewTLSConnectionState("shop.example.com"),
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	if req.RemoteAddr != "203.0.113.7:1234" {
+		t.Errorf("Expected RemoteAddr %q, got %q", "203.0.113.7:1234", req.RemoteAddr)
+	}
+	if req.Host != "shop.example.com" {
+		t.Errorf("Expected Host %q, got %q", "shop.example.com", req.Host)
+	}
+	if req.Proto != "HTTP/2.0" || req.ProtoMajor != 2 || req.ProtoMinor != 0 {
+		t.Errorf("Expected HTTP/2.0, got %s (%d.%d)", req.Proto, req.ProtoMajor, req.ProtoMinor)
+	}
+	if req.TLS == nil || !req.TLS.HandshakeComplete || req.TLS.ServerName != "shop.example.com" {
+		t.Errorf("Expected a completed TLS handshake, got %+v", req.TLS)
+	}
+
+	if _, err := NewRequest(http.MethodGet, "/", NewRequestOptions{Proto: "HTTP/x"}); err == nil {
+		t.Error("Expected an error for an invalid protocol version")
+	}
+	if _, err := NewRequest(http.MethodGet, "/", NewRequestOptions{RemoteAddr: "not an address"}); err == nil {
+		t.Error("Expected an error for an invalid remote address")
+	}
+}
+
+func TestNewRequestConnectionCheckedBeforeBody(t *testing.T) {
+	// The invalid connection is reported before the streamed body is started
+	_, err := NewRequest(http.MethodPost, "/", NewRequestOptions{
+		RemoteAddr: "not an address",
+		Multipart: &MultipartBody{
+			Files: []MultipartFile{FileFromReader("upload", "big.bin", strings.NewReader("data"))},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid remote address") {
+		t.Errorf("Expected an invalid remote address error, got %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "invalid connection") {
+			t.Errorf("Expected an invalid connection panic, got %v", r)
+		}
+	}()
+	NewTestHTTPRequest(http.MethodPost, "/").
+		WithProto("HTTP/x").
+		WithMultipartFile(FileFromReader("upload", "big.bin", strings.NewReader("data"))).
+		Execute(http.NotFoundHandler())
+}
+
+func TestNewRequestMutualTLS(t *testing.T) {
+	certificate, err := NewTestCertificate("client-1")
+	if err != nil {
+		t.Fatalf("NewTestCertificate failed: %v", err)
+	}
+
+	body, _, err := CallEndpoint(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}, NewRequestOptions{
+		TLS: NewTLSConnectionState("api.example.com", certificate),
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	if body != "client-1" {
+		t.Errorf("Expected the client certificate, got %q", body)
+	}
+}
+
+func TestNewRequestProxyChain(t *testing.T) {
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{
+		Proxy: &ProxyChain{
+			ClientIP: "203.0.113.7",
+			Proxies:  []string{"10.0.0.1", "10.0.0.2"},
+			Proto:    "https",
+			Host:     "shop.example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	if got := req.Header.Get("X-Forwarded-For"); got != "203.0.113.7, 10.0.0.1" {
+		t.Errorf("Expected X-Forwarded-For %q, got %q", "203.0.113.7, 10.0.0.1", got)
+	}
+	if req.Header.Get("X-Forwarded-Proto") != "https" || req.Header.Get("X-Forwarded-Host") != "shop.example.com" {
+		t.Errorf("Expected X-Forwarded-Proto and X-Forwarded-Host, got %v", req.Header)
+	}
+	if req.Header.Get("Forwarded") != "" {
+		t.Errorf("Expected no Forwarded header, got %q", req.Header.Get("Forwarded"))
+	}
+	if req.RemoteAddr != "10.0.0.2:1234" {
+		t.Errorf("Expected the last proxy as RemoteAddr, got %q", req.RemoteAddr)
+	}
+}
+
+func TestNewRequestForwarded(t *testing.T) {
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{
+		RemoteAddr: "192.0.2.10:443",
+		Proxy: &ProxyChain{
+			ClientIP: "2001:db8::1",
+			Proxies:  []string{"10.0.0.1", "10.0.0.2"},
+			Proto:    "https",
+			Host:     "shop.example.com:8443",
+			Headers:  ProxyHeadersForwarded,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	expected := `for="[2001:db8::1]";proto=https;host="shop.example.com:8443", for=10.0.0.1`
+	if got := req.Header.Get("Forwarded"); got != expected {
+		t.Errorf("Expected Forwarded %q, got %q", expected, got)
+	}
+	if req.Header.Get("X-Forwarded-For") != "" {
+		t.Errorf("Expected no X-Forwarded-For header, got %q", req.Header.Get("X-Forwarded-For"))
+	}
+
+	// An explicit RemoteAddr takes precedence
+	if req.RemoteAddr != "192.0.2.10:443" {
+		t.Errorf("Expected RemoteAddr %q, got %q", "192.0.2.10:443", req.RemoteAddr)
+	}
+
+	if _, err := NewRequest(http.MethodGet, "/", NewRequestOptions{Proxy: &ProxyChain{ClientIP: "203.0.113.7"}}); err == nil {
+		t.Error("Expected an error for a chain without proxies")
+	}
+}
+
+func TestTestHTTPRequestConnection(t *testing.T) {
+	var got *http.Request
+	NewTestHTTPRequest(http.MethodGet, "/").
+		WithRemoteAddr("198.51.100.4:5000").
+		WithHost("api.example.com").
+		WithProto("HTTP/1.0").
+		WithTLS(NewTLSConnectionState("api.example.com")).
+		WithProxy(&ProxyChain{ClientIP: "203.0.113.7", Proxies: []string{"10.0.0.1"}, Headers: ProxyHeadersBoth}).
+		Execute(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+		}))
+
+	if got.RemoteAddr != "198.51.100.4:5000" || got.Host != "api.example.com" || got.ProtoMinor != 0 || got.TLS == nil {
+		t.Errorf("Expected the connection properties, got %s %s %s %v", got.RemoteAddr, got.Host, got.Proto, got.TLS)
+	}
+	if got.Header.Get("X-Forwarded-For") != "203.0.113.7" || got.Header.Get("Forwarded") != "for=203.0.113.7" {
+		t.Errorf("Expected both proxy header styles, got %v", got.Header)
+	}
+}
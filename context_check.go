@@ -0,0 +1,264 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dbObservers holds the query observers of the databases opened with
+// DBConfig.CheckContexts
+var dbObservers sync.Map
+
+// queryObservers lets a check watch the queries executed on a database
+type queryObservers struct {
+	mu       sync.Mutex
+	observer func(ctx context.Context, query string) func(err error)
+}
+
+// start reports a query about to run and returns the function to call
+// with its error once it has run. A nil *queryObservers observes nothing.
+func (o *queryObservers) start(ctx context.Context, query string) func(err error) {
+	if o == nil {
+		return func(error) {}
+	}
+
+	o.mu.Lock()
+	observer := o.observer
+	o.mu.Unlock()
+
+	if observer == nil {
+		return func(error) {}
+	}
+	return observer(ctx, query)
+}
+
+// observe installs the observer, failing if another one is installed
+func (o *queryObservers) observe(observer func(ctx context.Context, query string) func(err error)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.observer != nil && observer != nil {
+		return fmt.Errorf("another context check is already running on this database")
+	}
+	o.observer = observer
+	return nil
+}
+
+// CancellationOptions configures VerifyContextCancellation
+type CancellationOptions struct {
+	// CancelAfter is how long after the handler starts the request context
+	// is cancelled. Defaults to 10ms unless CancelAfterQueries is set.
+	CancelAfter time.Duration
+
+	// CancelAfterQueries cancels the request context as soon as this many
+	// queries have completed, which makes the check deterministic
+	CancelAfterQueries int
+}
+
+// ContextQuery is a query run by the handler during VerifyContextCancellation
+type ContextQuery struct {
+	Query string
+
+	// RequestContext reports whether the query ran with the request
+	// context (or a context derived from it)
+	RequestContext bool
+
+	// AfterCancel reports whether the query started after the request
+	// context was cancelled
+	AfterCancel bool
+
+	// InFlight reports whether the query was running when the request
+	// context was cancelled
+	InFlight bool
+
+	// Err is the error the driver returned for the query
+	Err error
+}
+
+// Violation returns why the query ignored the request context, or "" if
+// it did not
+func (q ContextQuery) Violation() string {
+	switch {
+	case q.AfterCancel:
+		return "ran after the request context was done"
+	case !q.RequestContext:
+		return "did not use the request context"
+	}
+	return ""
+}
+
+// CancellationReport is the result of VerifyContextCancellation
+type CancellationReport struct {
+	Body     string
+	Response *http.Response
+
+	// Cancelled reports whether the request context was cancelled before
+	// the handler returned
+	Cancelled bool
+
+	// Queries lists the queries the handler ran, in the order they started
+	Queries []ContextQuery
+}
+
+// Violations returns the queries which ignored the request context
+func (r *CancellationReport) Violations() []ContextQuery {
+	violations := []ContextQuery{}
+	for _, q := range r.Queries {
+		if q.Violation() != "" {
+			violations = append(violations, q)
+		}
+	}
+	return violations
+}
+
+// Err returns an error listing the queries which ignored the request
+// context, or nil if there are none
+func (r *CancellationReport) Err() error {
+	violations := r.Violations()
+	if len(violations) == 0 {
+		return nil
+	}
+
+	lines := []string{fmt.Sprintf("%d queries ignored the request context:", len(violations))}
+	for _, q := range violations {
+		lines = append(lines, fmt.Sprintf("  %s: %s", q.Violation(), q.Query))
+	}
+
+	return errors.New(strings.Join(lines, "\n"))
+}
+
+// String renders every query with its relation to the request context
+func (r *CancellationReport) String() string {
+	lines := []string{fmt.Sprintf("%d queries, request context cancelled: %t", len(r.Queries), r.Cancelled)}
+	for _, q := range r.Queries {
+		status := "ok"
+		switch {
+		case q.Violation() != "":
+			status = q.Violation()
+		case q.InFlight && q.Err != nil:
+			status = "interrupted: " + q.Err.Error()
+		case q.InFlight:
+			status = "in flight, completed"
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", status, q.Query))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cancellationProbeKey marks the request context of a check, so queries
+// can be matched to it
+type cancellationProbeKey struct{}
+
+// VerifyContextCancellation runs the handler through CallEndpoint with a
+// request context that is cancelled mid-flight, and reports the queries the
+// handler ran on the database. Queries that did not use the request context
+// (e.g. context.Background()) or ran after it was done are violations, see
+// CancellationReport.Err. The database must be opened with
+// DBConfig.CheckContexts.
+func VerifyContextCancellation(db *sql.DB, method string, f func(w http.ResponseWriter, r *http.Request), options NewRequestOptions, opts *CancellationOptions) (*CancellationReport, error) {
+	value, ok := dbObservers.Load(db)
+	if !ok {
+		return nil, fmt.Errorf("VerifyContextCancellation requires a database opened with DBConfig.CheckContexts")
+	}
+	observers := value.(*queryObservers)
+
+	if opts == nil {
+		opts = &CancellationOptions{}
+	}
+
+	cancelAfter := opts.CancelAfter
+	if cancelAfter == 0 && opts.CancelAfterQueries == 0 {
+		cancelAfter = 10 * time.Millisecond
+	}
+
+	probe := new(int)
+	report := &CancellationReport{}
+
+	// mu guards the state shared with the observer, which also sees the
+	// queries of goroutines the handler leaves running
+	var mu sync.Mutex
+	queries := []ContextQuery{}
+	var cancel context.CancelFunc
+	cancelled := false
+	completed := 0
+
+	cancelRequest := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !cancelled && cancel != nil {
+			cancelled = true
+			cancel()
+		}
+	}
+
+	err := observers.observe(func(ctx context.Context, query string) func(err error) {
+		mu.Lock()
+		index := len(queries)
+		queries = append(queries, ContextQuery{
+			Query:          query,
+			RequestContext: ctx.Value(cancellationProbeKey{}) == probe,
+			AfterCancel:    cancelled,
+		})
+		mu.Unlock()
+
+		return func(err error) {
+			mu.Lock()
+			q := &queries[index]
+			q.Err = err
+			q.InFlight = cancelled && !q.AfterCancel
+			completed++
+			cancelNow := opts.CancelAfterQueries > 0 && completed == opts.CancelAfterQueries
+			mu.Unlock()
+
+			if cancelNow {
+				cancelRequest()
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer observers.observe(nil)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancelFunc := context.WithCancel(context.WithValue(r.Context(), cancellationProbeKey{}, probe))
+		defer cancelFunc()
+
+		mu.Lock()
+		cancel = cancelFunc
+		mu.Unlock()
+
+		if cancelAfter > 0 {
+			timer := time.AfterFunc(cancelAfter, cancelRequest)
+			defer timer.Stop()
+		}
+
+		f(w, r.WithContext(ctx))
+
+		mu.Lock()
+		report.Cancelled = cancelled
+		cancel = nil
+		mu.Unlock()
+	}
+
+	body, response, err := CallEndpoint(method, handler, options)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	report.Body = body
+	report.Response = response
+	report.Queries = append([]ContextQuery(nil), queries...)
+
+	return report, nil
+}
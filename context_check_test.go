@@ -0,0 +1,75 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyContextCancellation(t *testing.T) {
+	db := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:context_check?mode=memory&cache=shared", CheckContexts: true})
+
+	if err := ExecuteSQL(db, "CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	good := func(w http.ResponseWriter, r *http.Request) {
+		for range 3 {
+			if _, err := db.ExecContext(r.Context(), "INSERT INTO items DEFAULT VALUES"); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+	}
+
+	report, err := VerifyContextCancellation(db, http.MethodPost, good, NewRequestOptions{}, &CancellationOptions{CancelAfterQueries: 1})
+	if err != nil {
+		t.Fatalf("VerifyContextCancellation failed: %v", err)
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("Expected no violations for a handler using r.Context(), got %v", err)
+	}
+	if !report.Cancelled || len(report.Queries) != 1 || report.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the handler to stop after the cancellation, got status %d and\n%s", report.Response.StatusCode, report)
+	}
+
+	bad := func(w http.ResponseWriter, r *http.Request) {
+		db.ExecContext(r.Context(), "INSERT INTO items DEFAULT VALUES")
+		db.Exec("INSERT INTO items (id) VALUES (1000)")
+	}
+
+	report, err = VerifyContextCancellation(db, http.MethodPost, bad, NewRequestOptions{}, &CancellationOptions{CancelAfterQueries: 1})
+	if err != nil {
+		t.Fatalf("VerifyContextCancellation failed: %v", err)
+	}
+
+	violations := report.Violations()
+	if len(violations) != 1 || !violations[0].AfterCancel || violations[0].RequestContext {
+		t.Fatalf("Expected the query without the request context to be reported, got\n%s", report)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "VALUES (1000)") {
+		t.Errorf("Expected the error to name the query, got %v", err)
+	}
+
+	plain := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:context_check_plain?mode=memory&cache=shared"})
+	if _, err := VerifyContextCancellation(plain, http.MethodGet, good, NewRequestOptions{}, nil); err == nil {
+		t.Errorf("Expected an error for a database opened without CheckContexts")
+	}
+}
+
+func TestVerifyContextCancellationBackground(t *testing.T) {
+	db := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:context_check_background?mode=memory&cache=shared", CheckContexts: true})
+
+	report, err := VerifyContextCancellation(db, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		db.QueryRowContext(context.Background(), "SELECT 1").Scan(new(int))
+	}, NewRequestOptions{}, &CancellationOptions{CancelAfter: time.Minute})
+	if err != nil {
+		t.Fatalf("VerifyContextCancellation failed: %v", err)
+	}
+
+	if violations := report.Violations(); len(violations) != 1 || violations[0].Violation() != "did not use the request context" {
+		t.Errorf("Expected context.Background() to be reported, got\n%s", report)
+	}
+}
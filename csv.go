@@ -0,0 +1,424 @@
+package test
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSV column types used for type coercion on import
+const (
+	CSVString = "string"
+	CSVInt    = "int"
+	CSVFloat  = "float"
+	CSVBool   = "bool"
+	CSVTime   = "time"
+)
+
+// maxBindParams keeps batched inserts below the smallest bind parameter
+// limit of the supported drivers (SQLite builds before 3.32 allow 999)
+const maxBindParams = 999
+
+// CSVImportOptions configures ImportCSV
+type CSVImportOptions struct {
+	// Columns maps CSV headers to table columns. Headers not in the map are
+	// used as column names as they are; headers mapped to "" are skipped.
+	Columns map[string]string
+
+	// Types sets the type of a (table) column: CSVString, CSVInt, CSVFloat,
+	// CSVBool or CSVTime. Columns without a type are coerced based on the
+	// declared type of the table column, falling back to strings.
+	Types map[string]string
+
+	// NullValues are the field values imported as NULL.
+	// Defaults to "NULL" and `\N`.
+	NullValues []string
+
+	// BatchSize is the number of rows inserted per statement. Defaults to 100.
+	BatchSize int
+
+	// Comma is the field delimiter. Defaults to ','.
+	Comma rune
+}
+
+// CSVExportOptions configures ExportTableCSV and ExportQueryCSV
+type CSVExportOptions struct {
+	// NullValue is written for NULL values. Defaults to `\N`, which
+	// ImportCSV reads back as NULL.
+	NullValue string
+
+	// Comma is the field delimiter. Defaults to ','.
+	Comma rune
+}
+
+// ImportCSVFile loads a CSV file into a table, see ImportCSV
+func ImportCSVFile(db *sql.DB, table string, path string, opts CSVImportOptions) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return ImportCSV(db, table, file, opts)
+}
+
+// ImportCSV loads CSV data, whose first record is the header, into a table
+// and returns the number of rows imported. All rows are inserted inside a
+// single transaction, in batches. With the lib/pq driver COPY FROM STDIN
+// is used instead; other postgres drivers, such as pgx, use batched inserts.
+func ImportCSV(db *sql.DB, table string, r io.Reader, opts CSVImportOptions) (int, error) {
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	// Map CSV fields to table columns
+	columns := []string{}
+	fieldIndexes := []int{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if mapped, ok := opts.Columns[name]; ok {
+			name = mapped
+		}
+		if name == "" {
+			continue
+		}
+		columns = append(columns, name)
+		fieldIndexes = append(fieldIndexes, i)
+	}
+
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("CSV for table %s has no columns to import", table)
+	}
+
+	types, err := csvColumnTypes(db, table, columns, opts.Types)
+	if err != nil {
+		return 0, err
+	}
+
+	nullValues := opts.NullValues
+	if nullValues == nil {
+		nullValues = []string{"NULL", `\N`}
+	}
+
+	// Read and coerce all records up front, so errors point at the CSV line
+	records := [][]any{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		values := make([]any, len(columns))
+		for i, fieldIndex := range fieldIndexes {
+			if fieldIndex >= len(record) {
+				return 0, fmt.Errorf("CSV line %d: missing field for column %q", line, columns[i])
+			}
+
+			value, err := coerceCSVValue(record[fieldIndex], types[i], nullValues)
+			if err != nil {
+				return 0, fmt.Errorf("CSV line %d, column %q: %w", line, columns[i], err)
+			}
+			values[i] = value
+		}
+		records = append(records, values)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	if isLibPQ(db) {
+		copied, err := copyInPostgres(tx, table, columns, records)
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("failed to copy CSV rows into %s: %w", table, err)
+		}
+		return copied, tx.Commit()
+	}
+
+	if err := insertBatches(db, tx, table, columns, records, opts.BatchSize); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return len(records), tx.Commit()
+}
+
+// insertBatches inserts the records with multi-row INSERT statements
+func insertBatches(db *sql.DB, tx *sql.Tx, table string, columns []string, records [][]any, batchSize int) error {
+	dialect := DialectForDB(db)
+
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if batchSize*len(columns) > maxBindParams {
+		batchSize = max(1, maxBindParams/len(columns))
+	}
+
+	quotedColumns := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = dialect.QuoteIdentifier(column)
+	}
+
+	rowPlaceholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	for start := 0; start < len(records); start += batchSize {
+		end := min(start+batchSize, len(records))
+
+		placeholders := make([]string, 0, end-start)
+		args := make([]any, 0, (end-start)*len(columns))
+		for _, record := range records[start:end] {
+			placeholders = append(placeholders, rowPlaceholder)
+			args = append(args, record...)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+			dialect.QuoteIdentifier(table), strings.Join(quotedColumns, ", "), strings.Join(placeholders, ", "))
+
+		query, args, err := dialect.Rebind(query, args...)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to insert CSV rows %d-%d into %s: %w", start+1, end, table, err)
+		}
+	}
+
+	return nil
+}
+
+// isLibPQ reports whether db was opened with the lib/pq driver, the only
+// driver supporting COPY FROM STDIN through a prepared statement
+func isLibPQ(db *sql.DB) bool {
+	return strings.HasPrefix(fmt.Sprintf("%T", db.Driver()), "*pq.")
+}
+
+// copyInPostgres loads the records with COPY FROM STDIN, as supported by
+// the lib/pq driver through a prepared statement
+func copyInPostgres(tx *sql.Tx, table string, columns []string, records [][]any) (int, error) {
+	dialect := Dialect{name: DialectPostgres}
+
+	quotedColumns := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = dialect.QuoteIdentifier(column)
+	}
+
+	stmt, err := tx.Prepare(fmt.Sprintf("COPY %s (%s) FROM STDIN",
+		dialect.QuoteIdentifier(table), strings.Join(quotedColumns, ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, record := range records {
+		if _, err := stmt.Exec(record...); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		return 0, err
+	}
+
+	return len(records), nil
+}
+
+// csvColumnTypes returns the coercion type of each column, taken from the
+// explicit types or derived from the declared table column types
+func csvColumnTypes(db *sql.DB, table string, columns []string, explicit map[string]string) ([]string, error) {
+	declared := map[string]string{}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", DialectForDB(db).QuoteIdentifier(table)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of table %s: %w", table, err)
+	}
+	columnTypes, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of table %s: %w", table, err)
+	}
+
+	for _, columnType := range columnTypes {
+		declared[strings.ToLower(columnType.Name())] = csvTypeForDatabaseType(columnType.DatabaseTypeName())
+	}
+
+	types := make([]string, len(columns))
+	for i, column := range columns {
+		if columnType, ok := explicit[column]; ok {
+			types[i] = columnType
+			continue
+		}
+
+		columnType, ok := declared[strings.ToLower(column)]
+		if !ok {
+			return nil, fmt.Errorf("table %s has no column %q", table, column)
+		}
+		types[i] = columnType
+	}
+
+	return types, nil
+}
+
+// csvTinyInt is the type of MySQL TINYINT columns, which hold both small
+// numbers and booleans (TINYINT(1) is reported as TINYINT)
+const csvTinyInt = "tinyint"
+
+// csvTypeForDatabaseType maps a declared database column type to a CSV type
+func csvTypeForDatabaseType(databaseType string) string {
+	databaseType = strings.ToUpper(strings.TrimSpace(databaseType))
+
+	if databaseType == "TINYINT(1)" {
+		return CSVBool
+	}
+
+	// The type name without its size and modifiers, e.g. INT for
+	// "UNSIGNED INT" and TIMESTAMP for "TIMESTAMP(6) WITH TIME ZONE"
+	name := ""
+	for _, word := range strings.Fields(strings.NewReplacer("(", " (", ")", ") ").Replace(databaseType)) {
+		if strings.HasPrefix(word, "(") || strings.HasSuffix(word, ")") {
+			continue
+		}
+		if word != "UNSIGNED" && word != "SIGNED" && word != "ZEROFILL" {
+			name = word
+			break
+		}
+	}
+
+	switch name {
+	case "BOOLEAN", "BOOL":
+		return CSVBool
+	case "TINYINT":
+		return csvTinyInt
+	case "INT", "INTEGER", "SMALLINT", "MEDIUMINT", "BIGINT", "INT2", "INT4", "INT8",
+		"SERIAL", "SMALLSERIAL", "BIGSERIAL", "SERIAL2", "SERIAL4", "SERIAL8":
+		return CSVInt
+	case "REAL", "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE":
+		return CSVFloat
+	case "DATE", "DATETIME", "TIMESTAMP", "TIMESTAMPTZ":
+		return CSVTime
+	}
+
+	return CSVString
+}
+
+// csvTimeLayouts are the layouts accepted for CSVTime values
+var csvTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func coerceCSVValue(value string, csvType string, nullValues []string) (any, error) {
+	for _, null := range nullValues {
+		if value == null {
+			return nil, nil
+		}
+	}
+
+	switch csvType {
+	case CSVInt:
+		return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case CSVFloat:
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case CSVBool:
+		return strconv.ParseBool(strings.TrimSpace(value))
+	case csvTinyInt:
+		if number, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return number, nil
+		}
+		boolean, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as a number or boolean", value)
+		}
+		if boolean {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case CSVTime:
+		for _, layout := range csvTimeLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot parse %q as a time", value)
+	case CSVString, "":
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("unknown CSV type %q", csvType)
+}
+
+// ExportTableCSV writes every row of a table as CSV, with a header record
+func ExportTableCSV(db *sql.DB, table string, w io.Writer, opts CSVExportOptions) error {
+	return ExportQueryCSV(db, w, opts, "SELECT * FROM "+DialectForDB(db).QuoteIdentifier(table))
+}
+
+// ExportQueryCSV writes the result of a query as CSV, with a header record
+func ExportQueryCSV(db *sql.DB, w io.Writer, opts CSVExportOptions, query string, args ...any) error {
+	columns, rows, err := queryValues(db, query, args...)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		writer.Comma = opts.Comma
+	}
+
+	nullValue := opts.NullValue
+	if nullValue == "" {
+		nullValue = `\N`
+	}
+
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = formatCSVValue(value, nullValue)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatCSVValue(value any, nullValue string) string {
+	switch v := value.(type) {
+	case nil:
+		return nullValue
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestImportAndExportCSV(t *testing.T) {
+	db := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:csv_test?mode=memory&cache=shared"})
+
+	err := CreateTestTable(db, "csv_products", "id INTEGER PRIMARY KEY, name TEXT, price REAL, active BOOLEAN, note TEXT")
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+	defer DropTestTable(db, "csv_products")
+
+	input := strings.Join([]string{
+		"Product ID,Product Name,price,active,note,ignored",
+		"1,Widget,9.99,true,NULL,x",
+		"2,\"Gadget, large\",19.5,false,,y",
+		"3,Gizmo,0,1,\\N,z",
+	}, "\n")
+
+	count, err := ImportCSV(db, "csv_products", strings.NewReader(input), CSVImportOptions{
+		Columns: map[string]string{
+			"Product ID":   "id",
+			"Product Name": "name",
+			"ignored":      "",
+		},
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("ImportCSV failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 rows imported, got %d", count)
+	}
+
+	price, err := QueryScalar[float64](db, "SELECT price FROM csv_products WHERE id = 2")
+	if err != nil {
+		t.Fatalf("Failed to query price: %v", err)
+	}
+	if price != 19.5 {
+		t.Errorf("Expected price 19.5, got %v", price)
+	}
+
+	nulls, err := QueryScalar[int](db, "SELECT COUNT(*) FROM csv_products WHERE note IS NULL")
+	if err != nil {
+		t.Fatalf("Failed to count NULL notes: %v", err)
+	}
+	if nulls != 2 {
+		t.Errorf("Expected 2 NULL notes, got %d", nulls)
+	}
+
+	var out bytes.Buffer
+	err = ExportQueryCSV(db, &out, CSVExportOptions{NullValue: "NULL"}, "SELECT id, name, note FROM csv_products WHERE id <= ? ORDER BY id", 2)
+	if err != nil {
+		t.Fatalf("ExportQueryCSV failed: %v", err)
+	}
+
+	expected := "id,name,note\n1,Widget,NULL\n2,\"Gadget, large\",\n"
+	if out.String() != expected {
+		t.Errorf("Expected CSV %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := ExportTableCSV(db, "csv_products", &out, CSVExportOptions{}); err != nil {
+		t.Fatalf("ExportTableCSV failed: %v", err)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 4 {
+		t.Errorf("Expected a header and 3 rows, got %d lines:\n%s", lines, out.String())
+	}
+}
+
+func TestExportCSVRoundTrip(t *testing.T) {
+	db := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:csv_round_trip?mode=memory&cache=shared"})
+
+	for _, table := range []string{"csv_source", "csv_copy"} {
+		if err := CreateTestTable(db, table, "id INTEGER PRIMARY KEY, quantity INTEGER, shipped_at TIMESTAMP, note TEXT"); err != nil {
+			t.Fatalf("Failed to create test table: %v", err)
+		}
+		defer DropTestTable(db, table)
+	}
+
+	if err := ExecuteSQL(db, "INSERT INTO csv_source (id, quantity, shipped_at, note) VALUES (1, NULL, NULL, ''), (2, 5, '2024-03-05 12:00:00', NULL)"); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := ExportTableCSV(db, "csv_source", &out, CSVExportOptions{}); err != nil {
+		t.Fatalf("ExportTableCSV failed: %v", err)
+	}
+
+	if _, err := ImportCSV(db, "csv_copy", &out, CSVImportOptions{}); err != nil {
+		t.Fatalf("ImportCSV failed to read the export back: %v", err)
+	}
+
+	nulls, err := QueryScalar[string](db, "SELECT group_concat(id || ':' || (quantity IS NULL) || (shipped_at IS NULL) || (note IS NULL), ',') FROM csv_copy")
+	if err != nil {
+		t.Fatalf("Failed to query the copy: %v", err)
+	}
+	if nulls != "1:110,2:001" {
+		t.Errorf("Expected the NULLs to survive the round trip, got %q", nulls)
+	}
+}
+
+func TestImportCSVErrors(t *testing.T) {
+	db := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:csv_errors_test?mode=memory&cache=shared"})
+
+	err := CreateTestTable(db, "csv_numbers", "id INTEGER PRIMARY KEY, value INTEGER")
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+	defer DropTestTable(db, "csv_numbers")
+
+	_, err = ImportCSV(db, "csv_numbers", strings.NewReader("id,value\n1,2\n2,abc\n"), CSVImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line 3") || !strings.Contains(err.Error(), `"value"`) {
+		t.Errorf("Expected a coercion error naming line and column, got %v", err)
+	}
+
+	count, err := QueryScalar[int](db, "SELECT COUNT(*) FROM csv_numbers")
+	if err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no rows to be imported, got %d", count)
+	}
+
+	_, err = ImportCSV(db, "csv_numbers", strings.NewReader("id,missing\n1,2\n"), CSVImportOptions{})
+	if err == nil {
+		t.Errorf("Expected an error for an unknown column")
+	}
+}
+
+func TestCSVTypeForDatabaseType(t *testing.T) {
+	tests := map[string]string{
+		"INTEGER":                     CSVInt,
+		"UNSIGNED BIGINT":             CSVInt,
+		"int4":                        CSVInt,
+		"TINYINT":                     csvTinyInt,
+		"TINYINT(1)":                  CSVBool,
+		"BOOLEAN":                     CSVBool,
+		"DOUBLE PRECISION":            CSVFloat,
+		"FLOAT8":                      CSVFloat,
+		"DATETIME":                    CSVTime,
+		"TIMESTAMP(6) WITH TIME ZONE": CSVTime,
+		"POINT":                       CSVString,
+		"INTERVAL":                    CSVString,
+		"VARCHAR(255)":                CSVString,
+		"DECIMAL(10, 2)":              CSVString,
+	}
+
+	for databaseType, expected := range tests {
+		if got := csvTypeForDatabaseType(databaseType); got != expected {
+			t.Errorf("%s: expected %q, got %q", databaseType, expected, got)
+		}
+	}
+
+	for value, expected := range map[string]any{"3": int64(3), "true": int64(1), "false": int64(0)} {
+		got, err := coerceCSVValue(value, csvTinyInt, nil)
+		if err != nil || got != expected {
+			t.Errorf("%s: expected %v, got %v (%v)", value, expected, got, err)
+		}
+	}
+}
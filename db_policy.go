@@ -0,0 +1,104 @@
+package test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// DefaultRequireDBEnv is the environment variable that, when set to a true
+// value (e.g. in CI), makes NewTestDBOrSkip fail instead of skip
+const DefaultRequireDBEnv = "TEST_REQUIRE_DB"
+
+// DBPolicy configures how NewTestDBOrSkip handles an unavailable database
+type DBPolicy struct {
+	// RequireEnv names the environment variable which, when true, turns
+	// skips into failures. Defaults to DefaultRequireDBEnv.
+	RequireEnv string
+
+	// WaitTimeout is how long to keep retrying the ping while the database
+	// is starting, for example in a container. Defaults to 30 seconds when
+	// the database is required and to a single attempt otherwise.
+	WaitTimeout time.Duration
+
+	// InitialBackoff is the delay before the first retry. Defaults to 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the exponentially growing delay between retries.
+	// Defaults to 2 seconds.
+	MaxBackoff time.Duration
+}
+
+// NewTestDBOrSkip creates a test database which is closed when the test
+// finishes. If the driver is not registered or the server cannot be
+// reached, the test is skipped with the reason, unless the RequireEnv
+// variable (TEST_REQUIRE_DB by default) is true, in which case it fails.
+// Ping failures are retried with exponential backoff for WaitTimeout.
+// Configuration errors always fail the test. A nil policy uses the defaults.
+func NewTestDBOrSkip(t testing.TB, config *DBConfig, policy *DBPolicy) *sql.DB {
+	t.Helper()
+
+	if policy == nil {
+		policy = &DBPolicy{}
+	}
+
+	requireEnv := policy.RequireEnv
+	if requireEnv == "" {
+		requireEnv = DefaultRequireDBEnv
+	}
+	required, _ := strconv.ParseBool(os.Getenv(requireEnv))
+
+	wait := policy.WaitTimeout
+	if wait == 0 && required {
+		wait = 30 * time.Second
+	}
+
+	backoff := policy.InitialBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 2 * time.Second
+	}
+
+	deadline := time.Now().Add(wait)
+
+	var db *sql.DB
+	var err error
+
+	for {
+		db, err = NewTestDB(config)
+		if err == nil || !errors.Is(err, ErrDatabaseUnavailable) || time.Now().Add(backoff).After(deadline) {
+			break
+		}
+
+		t.Logf("test database unavailable, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+
+	if err != nil {
+		unavailable := errors.Is(err, ErrDatabaseUnavailable) || errors.Is(err, ErrDriverNotRegistered)
+
+		if unavailable && !required {
+			t.Skipf("skipping, test database is unavailable (set %s=1 to fail instead): %v", requireEnv, err)
+			return nil
+		}
+
+		t.Fatalf("failed to create test database: %v", err)
+		return nil
+	}
+
+	t.Cleanup(func() {
+		if err := CloseTestDB(db); err != nil {
+			t.Errorf("failed to close test database: %v", err)
+		}
+	})
+
+	return db
+}
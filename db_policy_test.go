@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// policyTB records skips and failures instead of stopping the test
+type policyTB struct {
+	testing.TB
+	skipped string
+	fatal   string
+}
+
+func (tb *policyTB) Helper()                   {}
+func (tb *policyTB) Logf(string, ...any)       {}
+func (tb *policyTB) Errorf(f string, a ...any) { tb.fatal = fmt.Sprintf(f, a...) }
+func (tb *policyTB) Skipf(f string, a ...any)  { tb.skipped = fmt.Sprintf(f, a...) }
+func (tb *policyTB) Fatalf(f string, a ...any) { tb.fatal = fmt.Sprintf(f, a...) }
+
+// flakyDriver refuses connections until it has been asked a number of times
+type flakyDriver struct {
+	failures atomic.Int32
+}
+
+func (d *flakyDriver) Open(name string) (driver.Conn, error) {
+	if d.failures.Add(-1) >= 0 {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	}
+	return (&sqlite.Driver{}).Open(name)
+}
+
+func TestNewTestDBOrSkipUnavailable(t *testing.T) {
+	t.Setenv(DefaultRequireDBEnv, "")
+
+	tb := &policyTB{TB: t}
+	if db := NewTestDBOrSkip(tb, &DBConfig{Driver: "not_registered"}, nil); db != nil {
+		t.Fatalf("Expected no database for an unregistered driver")
+	}
+	if !strings.Contains(tb.skipped, "not_registered") || tb.fatal != "" {
+		t.Errorf("Expected the test to be skipped with the reason, got skip %q and failure %q", tb.skipped, tb.fatal)
+	}
+
+	t.Setenv(DefaultRequireDBEnv, "true")
+
+	tb = &policyTB{TB: t}
+	NewTestDBOrSkip(tb, &DBConfig{Driver: "not_registered"}, &DBPolicy{WaitTimeout: time.Millisecond})
+	if tb.fatal == "" || tb.skipped != "" {
+		t.Errorf("Expected the test to fail when %s is set, got skip %q and failure %q", DefaultRequireDBEnv, tb.skipped, tb.fatal)
+	}
+}
+
+func TestNewTestDBOrSkipConfigError(t *testing.T) {
+	t.Setenv(DefaultRequireDBEnv, "")
+
+	tb := &policyTB{TB: t}
+	NewTestDBOrSkip(tb, &DBConfig{Driver: "sqlite", Database: ":memory:", SQLiteFile: true}, nil)
+	if tb.fatal == "" {
+		t.Errorf("Expected configuration errors to fail the test, got skip %q", tb.skipped)
+	}
+}
+
+// flaky is registered once, so the tests can run repeatedly (-count)
+var (
+	flaky         = &flakyDriver{}
+	registerFlaky sync.Once
+)
+
+func TestNewTestDBOrSkipRetries(t *testing.T) {
+	registerFlaky.Do(func() { sql.Register("sqlite_flaky", flaky) })
+	flaky.failures.Store(2)
+
+	tb := &policyTB{TB: t}
+	db := NewTestDBOrSkip(tb, &DBConfig{Driver: "sqlite_flaky", DSN: "file:flaky?mode=memory&cache=shared"}, &DBPolicy{
+		WaitTimeout:    time.Second,
+		InitialBackoff: time.Millisecond,
+	})
+	if db == nil {
+		t.Fatalf("Expected the database once it accepts connections, got skip %q and failure %q", tb.skipped, tb.fatal)
+	}
+
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+}
+
+// deniedDriver rejects every connection with the given error
+type deniedDriver struct {
+	err error
+}
+
+func (d *deniedDriver) Open(name string) (driver.Conn, error) {
+	return nil, d.err
+}
+
+var registerDenied sync.Once
+
+func TestNewTestDBUnavailableErrors(t *testing.T) {
+	registerDenied.Do(func() {
+		sql.Register("sqlite_denied", &deniedDriver{err: errors.New("password authentication failed for user \"test\"")})
+		sql.Register("sqlite_unresolved", &deniedDriver{err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "db"}}})
+		sql.Register("sqlite_timeout", &deniedDriver{err: &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}})
+	})
+
+	tests := []struct {
+		driver      string
+		unavailable bool
+	}{
+		{"sqlite_denied", false},
+		{"sqlite_unresolved", true},
+		{"sqlite_timeout", true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewTestDB(&DBConfig{Driver: tt.driver, DSN: "test"})
+		if err == nil {
+			t.Fatalf("Expected an error for %s", tt.driver)
+		}
+		if errors.Is(err, ErrDatabaseUnavailable) != tt.unavailable {
+			t.Errorf("Expected unavailable %v for %s, got %v", tt.unavailable, tt.driver, err)
+		}
+	}
+
+	// Authentication errors fail the test instead of skipping it
+	t.Setenv(DefaultRequireDBEnv, "")
+
+	tb := &policyTB{TB: t}
+	NewTestDBOrSkip(tb, &DBConfig{Driver: "sqlite_denied", DSN: "test"}, &DBPolicy{WaitTimeout: time.Millisecond})
+	if tb.fatal == "" || tb.skipped != "" {
+		t.Errorf("Expected authentication errors to fail the test, got skip %q and failure %q", tb.skipped, tb.fatal)
+	}
+}
@@ -0,0 +1,363 @@
+package test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect describes the SQL flavour spoken by a database driver. It rewrites
+// placeholders and quotes identifiers, so the same test SQL can be run
+// against every driver supported by NewTestDB.
+type Dialect struct {
+	name string
+}
+
+// DialectFor returns the dialect for a database/sql driver name
+// (e.g. "sqlite", "mysql", "postgres", "pgx")
+func DialectFor(driver string) (Dialect, error) {
+	name := normalizeDriver(driver)
+	if name == "" {
+		return Dialect{}, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+	return Dialect{name: name}, nil
+}
+
+// DialectForDB returns the dialect of the driver the database was opened
+// with. For unrecognised drivers a dialect using "?" placeholders and
+// standard identifier quoting is returned.
+func DialectForDB(db *sql.DB) Dialect {
+	return Dialect{name: normalizeDriver(driverForDB(db))}
+}
+
+// Name returns the name of the dialect (DialectSQLite, DialectMySQL or
+// DialectPostgres), or an empty string if the dialect is unknown
+func (d Dialect) Name() string {
+	return d.name
+}
+
+// Placeholder returns the bind placeholder for the n-th (1-based) argument
+func (d Dialect) Placeholder(n int) string {
+	if d.name == DialectPostgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// QuoteIdentifier quotes a table or column name. Qualified names such as
+// "schema.table" are quoted part by part.
+func (d Dialect) QuoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(d.name, part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Rebind rewrites the placeholders in query to the style of the dialect and
+// returns the arguments in the order the rewritten query expects them.
+//
+// Positional placeholders may be written as "?" or "$N". Named placeholders
+// (":name" or "@name") are recognised when the arguments are a single map
+// with string keys, a single struct (fields are matched by their `db` tag,
+// or by name), or a list of sql.NamedArg values. A single map or struct is
+// bound positionally if the query has no named placeholders.
+//
+// The postgres JSONB operators "?|" and "?&" are left as they are, and "?||"
+// is a placeholder followed by the concatenation operator. Write
+// the "?" operator (and any other literal question mark outside of quotes)
+// as "??", e.g. "data ?? 'key'".
+func (d Dialect) Rebind(query string, args ...any) (string, []any, error) {
+	named, isNamed, err := namedArgs(args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rebound, boundArgs, sawNamed, err := d.rebind(query, args, named, isNamed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// A single map or struct is a plain value when the query has no named
+	// placeholders, e.g. for a JSON column
+	if isNamed && !sawNamed {
+		if _, ok := args[0].(sql.NamedArg); !ok {
+			rebound, boundArgs, _, err = d.rebind(query, args, nil, false)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	return rebound, boundArgs, nil
+}
+
+// rebind rewrites the placeholders of query, reporting whether named
+// placeholders were found
+func (d Dialect) rebind(query string, args []any, named map[string]any, isNamed bool) (string, []any, bool, error) {
+	var out strings.Builder
+	boundArgs := []any{}
+	positional := 0
+	style := ""
+	sawNamed := false
+
+	setStyle := func(s string) error {
+		if style != "" && style != s {
+			return fmt.Errorf("query mixes %s and %s placeholders: %s", style, s, query)
+		}
+		style = s
+		return nil
+	}
+
+	bind := func(value any) {
+		boundArgs = append(boundArgs, value)
+		out.WriteString(d.Placeholder(len(boundArgs)))
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				out.WriteString(query[i:])
+				i = len(query)
+				continue
+			}
+			out.WriteString(query[i : i+end+2])
+			i += end + 1
+
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			out.WriteString(query[i : i+end])
+			i += end - 1
+
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				out.WriteString(query[i:])
+				i = len(query)
+				continue
+			}
+			out.WriteString(query[i : i+end+4])
+			i += end + 3
+
+		case c == '?' && i+1 < len(query) && query[i+1] == '?':
+			// Escaped question mark
+			out.WriteByte('?')
+			i++
+
+		case c == '?' && i+1 < len(query) && (query[i+1] == '|' || query[i+1] == '&') && !strings.HasPrefix(query[i+1:], "||"):
+			// JSONB ?| and ?& operators, but not a placeholder followed by ||
+			out.WriteString(query[i : i+2])
+			i++
+
+		case c == '?' && !isNamed:
+			if err := setStyle("?"); err != nil {
+				return "", nil, false, err
+			}
+			if positional >= len(args) {
+				return "", nil, false, fmt.Errorf("query has more placeholders than the %d arguments given: %s", len(args), query)
+			}
+			bind(args[positional])
+			positional++
+
+		case c == '$' && !isNamed && i+1 < len(query) && isDigit(query[i+1]):
+			if err := setStyle("$N"); err != nil {
+				return "", nil, false, err
+			}
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			if n < 1 || n > len(args) {
+				return "", nil, false, fmt.Errorf("placeholder $%d is out of range for the %d arguments given: %s", n, len(args), query)
+			}
+			if n > positional {
+				positional = n
+			}
+			bind(args[n-1])
+			i = j - 1
+
+		case (c == ':' || c == '@') && isNamed && i+1 < len(query) && isIdentStart(query[i+1]) && (i == 0 || query[i-1] != ':'):
+			j := i + 1
+			for j < len(query) && isIdentChar(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			value, ok := named[name]
+			if !ok {
+				value, ok = named[strings.ToLower(name)]
+			}
+			if !ok {
+				return "", nil, false, fmt.Errorf("no value given for named parameter %q: %s", name, query)
+			}
+			bind(value)
+			sawNamed = true
+			i = j - 1
+
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	if style == "" && !isNamed {
+		// No placeholders were found, leave the arguments for the driver to check
+		return out.String(), args, false, nil
+	}
+
+	if !isNamed && positional != len(args) {
+		return "", nil, false, fmt.Errorf("query uses %d of the %d arguments given: %s", positional, len(args), query)
+	}
+
+	return out.String(), boundArgs, sawNamed, nil
+}
+
+// RebindSQL rewrites the placeholders of query for the dialect of db,
+// see Dialect.Rebind
+func RebindSQL(db *sql.DB, query string, args ...any) (string, []any, error) {
+	return DialectForDB(db).Rebind(query, args...)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+// namedArgs returns the named values held by args, if args are named
+func namedArgs(args []any) (map[string]any, bool, error) {
+	if len(args) == 0 {
+		return nil, false, nil
+	}
+
+	if _, ok := args[0].(sql.NamedArg); ok {
+		named := map[string]any{}
+		for _, arg := range args {
+			namedArg, ok := arg.(sql.NamedArg)
+			if !ok {
+				return nil, false, fmt.Errorf("cannot mix sql.NamedArg and positional arguments")
+			}
+			named[namedArg.Name] = namedArg.Value
+		}
+		return named, true, nil
+	}
+
+	if len(args) != 1 || args[0] == nil {
+		return nil, false, nil
+	}
+
+	switch args[0].(type) {
+	case time.Time, *time.Time, driver.Valuer, []byte:
+		return nil, false, nil
+	}
+
+	value := reflect.ValueOf(args[0])
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil, false, nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, false, nil
+		}
+		named := map[string]any{}
+		iter := value.MapRange()
+		for iter.Next() {
+			named[iter.Key().String()] = iter.Value().Interface()
+		}
+		return named, true, nil
+	case reflect.Struct:
+		named := map[string]any{}
+		for _, field := range structFields(value.Type()) {
+			fieldValue, err := value.FieldByIndexErr(field.index)
+			if err != nil {
+				// nil embedded pointer, the field has no value
+				continue
+			}
+			named[field.name] = fieldValue.Interface()
+			named[strings.ToLower(field.name)] = fieldValue.Interface()
+		}
+		return named, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// dbField is an exported struct field mapped to a database column
+type dbField struct {
+	name  string
+	index []int
+}
+
+// structFields returns the exported fields of a struct type keyed by their
+// `db` tag (falling back to the field name). Fields of embedded structs are
+// flattened, fields tagged `db:"-"` are skipped.
+func structFields(structType reflect.Type) []dbField {
+	fields := []dbField{}
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag := field.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct && !isScannerType(fieldType) {
+			for _, embedded := range structFields(fieldType) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields = append(fields, dbField{name: name, index: []int{i}})
+	}
+
+	return fields
+}
+
+// isScannerType reports whether values of the type are handled by
+// database/sql directly (time.Time, sql.Null* and custom scanners), so
+// they must not be flattened as embedded structs
+func isScannerType(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	scannerType := reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	return reflect.PointerTo(t).Implements(scannerType)
+}
@@ -0,0 +1,169 @@
+package test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestDialectRebind(t *testing.T) {
+	sqlite, _ := DialectFor("sqlite")
+	mysql, _ := DialectFor("mysql")
+	postgres, _ := DialectFor("pgx")
+
+	tests := []struct {
+		name          string
+		dialect       Dialect
+		query         string
+		args          []any
+		expectedQuery string
+		expectedArgs  []any
+	}{
+		{
+			name:          "question marks to postgres",
+			dialect:       postgres,
+			query:         "SELECT * FROM users WHERE name = ? AND note = '?' AND email = ?",
+			args:          []any{"a", "b"},
+			expectedQuery: "SELECT * FROM users WHERE name = $1 AND note = '?' AND email = $2",
+			expectedArgs:  []any{"a", "b"},
+		},
+		{
+			name:          "postgres JSONB operators",
+			dialect:       postgres,
+			query:         "SELECT * FROM users WHERE data ?? 'admin' AND data ?| array['a'] AND data ?& array['b'] AND id = ?",
+			args:          []any{1},
+			expectedQuery: "SELECT * FROM users WHERE data ? 'admin' AND data ?| array['a'] AND data ?& array['b'] AND id = $1",
+			expectedArgs:  []any{1},
+		},
+		{
+			name:          "escaped question mark without arguments",
+			dialect:       postgres,
+			query:         "SELECT data ?? 'admin' FROM users",
+			expectedQuery: "SELECT data ? 'admin' FROM users",
+		},
+		{
+			name:          "placeholder before concatenation",
+			dialect:       postgres,
+			query:         "SELECT ?||name FROM users",
+			args:          []any{"a"},
+			expectedQuery: "SELECT $1||name FROM users",
+			expectedArgs:  []any{"a"},
+		},
+		{
+			name:          "dollar placeholders to mysql",
+			dialect:       mysql,
+			query:         "SELECT * FROM users WHERE email = $2 OR name = $1 OR alias = $1",
+			args:          []any{"a", "b"},
+			expectedQuery: "SELECT * FROM users WHERE email = ? OR name = ? OR alias = ?",
+			expectedArgs:  []any{"b", "a", "a"},
+		},
+		{
+			name:          "named map to postgres keeps casts",
+			dialect:       postgres,
+			query:         "SELECT :id::text, @name -- :ignored\nFROM users",
+			args:          []any{map[string]any{"id": 1, "name": "a"}},
+			expectedQuery: "SELECT $1::text, $2 -- :ignored\nFROM users",
+			expectedArgs:  []any{1, "a"},
+		},
+		{
+			name:    "named struct to sqlite",
+			dialect: sqlite,
+			query:   "INSERT INTO users (name, email) VALUES (:name, :Email)",
+			args: []any{struct {
+				Name  string `db:"name"`
+				Email string
+			}{Name: "a", Email: "b"}},
+			expectedQuery: "INSERT INTO users (name, email) VALUES (?, ?)",
+			expectedArgs:  []any{"a", "b"},
+		},
+		{
+			name:          "sql.NamedArg",
+			dialect:       postgres,
+			query:         "SELECT * FROM users WHERE id = @id",
+			args:          []any{sql.Named("id", 7)},
+			expectedQuery: "SELECT * FROM users WHERE id = $1",
+			expectedArgs:  []any{7},
+		},
+		{
+			name:          "single map bound positionally",
+			dialect:       postgres,
+			query:         "INSERT INTO settings (value) VALUES (?)",
+			args:          []any{map[string]any{"theme": "dark"}},
+			expectedQuery: "INSERT INTO settings (value) VALUES ($1)",
+			expectedArgs:  []any{map[string]any{"theme": "dark"}},
+		},
+	}
+
+	for _, tt := range tests {
+		query, args, err := tt.dialect.Rebind(tt.query, tt.args...)
+		if err != nil {
+			t.Fatalf("%s: Rebind failed: %v", tt.name, err)
+		}
+		if query != tt.expectedQuery {
+			t.Errorf("%s: expected query %q, got %q", tt.name, tt.expectedQuery, query)
+		}
+		if !reflect.DeepEqual(args, tt.expectedArgs) {
+			t.Errorf("%s: expected args %v, got %v", tt.name, tt.expectedArgs, args)
+		}
+	}
+
+	if _, _, err := postgres.Rebind("SELECT ?, $1", 1); err == nil {
+		t.Errorf("Expected an error when mixing placeholder styles")
+	}
+	if _, _, err := postgres.Rebind("SELECT :missing", map[string]any{}); err == nil {
+		t.Errorf("Expected an error for a missing named parameter")
+	}
+	if _, _, err := postgres.Rebind("SELECT ?, ?", 1); err == nil {
+		t.Errorf("Expected an error for too few arguments")
+	}
+}
+
+func TestDialectQuoteIdentifier(t *testing.T) {
+	mysql, _ := DialectFor("mysql")
+	postgres, _ := DialectFor("postgres")
+
+	if got := mysql.QuoteIdentifier("users"); got != "`users`" {
+		t.Errorf("Expected %q, got %q", "`users`", got)
+	}
+	if got := postgres.QuoteIdentifier(`public.we"ird`); got != `"public"."we""ird"` {
+		t.Errorf("Expected %q, got %q", `"public"."we""ird"`, got)
+	}
+	if _, err := DialectFor("oracle"); err == nil {
+		t.Errorf("Expected an error for an unsupported driver")
+	}
+}
+
+func TestExecuteSQLWithArgsRebinds(t *testing.T) {
+	db, err := NewTestDB(nil)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer CloseTestDB(db)
+
+	err = CreateTestTable(db, "rebind_users", "id INTEGER PRIMARY KEY, name TEXT, email TEXT")
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+	defer DropTestTable(db, "rebind_users")
+
+	err = ExecuteSQLWithArgs(db, "INSERT INTO rebind_users (name, email) VALUES ($1, $2)", "Test User", "test@example.com")
+	if err != nil {
+		t.Fatalf("Failed to insert with $N placeholders: %v", err)
+	}
+
+	err = ExecuteSQLWithArgs(db, "INSERT INTO rebind_users (name, email) VALUES (:name, :email)", map[string]any{
+		"name":  "Named User",
+		"email": "named@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert with named placeholders: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM rebind_users").Scan(&count); err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 rows, got %d", count)
+	}
+}
@@ -0,0 +1,201 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DSNBuilder builds the data source name passed to sql.Open for a database
+// configuration
+type DSNBuilder func(config *DBConfig) (string, error)
+
+var (
+	dsnBuildersMu sync.RWMutex
+	dsnBuilders   = map[string]DSNBuilder{
+		"sqlite":   sqliteDSNBuilder,
+		"sqlite3":  sqlite3DSNBuilder,
+		"libsql":   libsqlDSNBuilder,
+		"mysql":    mysqlDSNBuilder,
+		"postgres": postgresDSNBuilder,
+		"pgx":      postgresDSNBuilder,
+	}
+)
+
+// RegisterDSNBuilder registers the DSN builder used by NewTestDB for a
+// driver name, replacing any existing builder for that driver. Use it to
+// support drivers registered by your application under another name.
+func RegisterDSNBuilder(driver string, builder DSNBuilder) {
+	dsnBuildersMu.Lock()
+	defer dsnBuildersMu.Unlock()
+
+	dsnBuilders[driver] = builder
+}
+
+// BuildDSN returns the data source name NewTestDB opens for the
+// configuration: DSN if set, otherwise the result of the DSN builder
+// registered for the driver
+func BuildDSN(config *DBConfig) (string, error) {
+	if config.DSN != "" {
+		return config.DSN, nil
+	}
+
+	dsnBuildersMu.RLock()
+	builder, ok := dsnBuilders[config.Driver]
+	dsnBuildersMu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("unsupported database driver: %s. Register a DSN builder with RegisterDSNBuilder or set DBConfig.DSN", config.Driver)
+	}
+
+	return builder(config)
+}
+
+// withDefaults returns the options with defaults filled in for missing keys
+func withDefaults(options map[string]string, defaults map[string]string) map[string]string {
+	merged := map[string]string{}
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range options {
+		merged[key] = value
+	}
+	return merged
+}
+
+// sortedKeys returns the keys of a map in sorted order, so DSNs are stable
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendQuery appends URL query parameters to a DSN
+func appendQuery(dsn string, params map[string]string) string {
+	if len(params) == 0 {
+		return dsn
+	}
+
+	values := url.Values{}
+	for key, value := range params {
+		values.Set(key, value)
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+
+	return dsn + separator + values.Encode()
+}
+
+// sqliteDSNBuilder builds DSNs for modernc.org/sqlite, where pragmas are
+// passed as "_pragma=name(value)" parameters
+func sqliteDSNBuilder(config *DBConfig) (string, error) {
+	if config.SQLiteFile && isSQLiteMemory(config.Database) {
+		return "", fmt.Errorf("SQLiteFile requires a database file path, use NewTestDBT to create one in t.TempDir()")
+	}
+
+	return appendQuery(sqliteDSN(config.Database, sqlitePragmas(config)), config.Options), nil
+}
+
+// sqlite3DSNBuilder builds DSNs for github.com/mattn/go-sqlite3, where
+// pragmas are passed as "_name=value" parameters
+func sqlite3DSNBuilder(config *DBConfig) (string, error) {
+	if config.SQLiteFile && isSQLiteMemory(config.Database) {
+		return "", fmt.Errorf("SQLiteFile requires a database file path, use NewTestDBT to create one in t.TempDir()")
+	}
+
+	params := map[string]string{}
+	for name, value := range sqlitePragmas(config) {
+		params["_"+name] = value
+	}
+
+	dsn := config.Database
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+
+	return appendQuery(dsn, withDefaults(config.Options, params)), nil
+}
+
+// libsqlDSNBuilder builds DSNs for github.com/tursodatabase/libsql-client-go
+// and go-libsql: a libsql:// URL when a host is configured (Password is
+// sent as the authToken), a local SQLite file otherwise
+func libsqlDSNBuilder(config *DBConfig) (string, error) {
+	if config.Host == "" {
+		return sqliteDSNBuilder(config)
+	}
+
+	host := config.Host
+	if config.Port != "" {
+		host = net.JoinHostPort(config.Host, config.Port)
+	}
+
+	params := map[string]string{}
+	if config.Password != "" {
+		params["authToken"] = config.Password
+	}
+
+	u := url.URL{Scheme: "libsql", Host: host}
+	return appendQuery(u.String(), withDefaults(config.Options, params)), nil
+}
+
+// mysqlDSNBuilder builds DSNs for github.com/go-sql-driver/mysql. The
+// parseTime=true default can be overridden through Options.
+func mysqlDSNBuilder(config *DBConfig) (string, error) {
+	address := config.Host
+	if config.Port != "" {
+		address = net.JoinHostPort(config.Host, config.Port)
+	}
+
+	// The driver splits the credentials from the address at the last "@",
+	// so the password needs no escaping
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", config.Username, config.Password, address, config.Database)
+
+	return appendQuery(dsn, withDefaults(config.Options, map[string]string{"parseTime": "true"})), nil
+}
+
+// postgresDSNBuilder builds key=value DSNs understood by both lib/pq and
+// pgx. The sslmode=disable default can be overridden through Options, any
+// other option (e.g. search_path, timezone) is passed through.
+func postgresDSNBuilder(config *DBConfig) (string, error) {
+	params := []string{}
+
+	add := func(key string, value string) {
+		if value != "" {
+			params = append(params, key+"="+quotePostgresDSNValue(value))
+		}
+	}
+
+	add("host", config.Host)
+	add("port", config.Port)
+	add("user", config.Username)
+	add("password", config.Password)
+	add("dbname", config.Database)
+
+	options := withDefaults(config.Options, map[string]string{"sslmode": "disable"})
+	for _, key := range sortedKeys(options) {
+		add(key, options[key])
+	}
+
+	return strings.Join(params, " "), nil
+}
+
+// quotePostgresDSNValue quotes a key=value DSN value if it is empty or
+// contains spaces, quotes or backslashes
+func quotePostgresDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
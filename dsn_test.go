@@ -0,0 +1,100 @@
+package test
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"modernc.org/sqlite"
+)
+
+func TestBuildDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *DBConfig
+		expected string
+	}{
+		{
+			name: "mysql with options",
+			config: &DBConfig{
+				Driver: "mysql", Host: "localhost", Port: "3306", Database: "app",
+				Username: "root", Password: "p@ss/word",
+				Options: map[string]string{"charset": "utf8mb4", "loc": "Europe/Berlin"},
+			},
+			expected: "root:p@ss/word@tcp(localhost:3306)/app?charset=utf8mb4&loc=Europe%2FBerlin&parseTime=true",
+		},
+		{
+			name: "mysql overriding parseTime",
+			config: &DBConfig{
+				Driver: "mysql", Host: "localhost", Database: "app", Username: "root",
+				Options: map[string]string{"parseTime": "false"},
+			},
+			expected: "root:@tcp(localhost)/app?parseTime=false",
+		},
+		{
+			name: "postgres with escaped password",
+			config: &DBConfig{
+				Driver: "postgres", Host: "localhost", Port: "5432", Database: "app",
+				Username: "app", Password: `it's a \secret`,
+				Options: map[string]string{"search_path": "tenant,public", "sslmode": "require"},
+			},
+			expected: `host=localhost port=5432 user=app password='it\'s a \\secret' dbname=app search_path=tenant,public sslmode=require`,
+		},
+		{
+			name:     "pgx",
+			config:   &DBConfig{Driver: "pgx", Host: "db", Database: "app"},
+			expected: "host=db dbname=app sslmode=disable",
+		},
+		{
+			name:     "sqlite3 pragmas",
+			config:   &DBConfig{Driver: "sqlite3", Database: "/tmp/app.db", Pragmas: map[string]string{"foreign_keys": "on"}},
+			expected: "file:/tmp/app.db?_foreign_keys=on",
+		},
+		{
+			name:     "libsql remote",
+			config:   &DBConfig{Driver: "libsql", Host: "app.turso.io", Password: "token"},
+			expected: "libsql://app.turso.io?authToken=token",
+		},
+		{
+			name:     "raw DSN",
+			config:   &DBConfig{Driver: "unknown", DSN: "anything goes"},
+			expected: "anything goes",
+		},
+	}
+
+	for _, tt := range tests {
+		dsn, err := BuildDSN(tt.config)
+		if err != nil {
+			t.Fatalf("%s: BuildDSN failed: %v", tt.name, err)
+		}
+		if dsn != tt.expected {
+			t.Errorf("%s: expected DSN %q, got %q", tt.name, tt.expected, dsn)
+		}
+	}
+
+	if _, err := BuildDSN(&DBConfig{Driver: "unknown"}); err == nil {
+		t.Errorf("Expected an error for a driver without DSN builder")
+	}
+}
+
+// registerCustomDSNDriver registers the test driver once, so the tests can
+// run repeatedly (-count)
+var registerCustomDSNDriver sync.Once
+
+func TestRegisterDSNBuilder(t *testing.T) {
+	registerCustomDSNDriver.Do(func() { sql.Register("sqlite_custom_dsn", &sqlite.Driver{}) })
+
+	RegisterDSNBuilder("sqlite_custom_dsn", func(config *DBConfig) (string, error) {
+		return "file:" + config.Database + "?mode=memory&cache=shared", nil
+	})
+
+	db, err := NewTestDB(&DBConfig{Driver: "sqlite_custom_dsn", Database: "custom_dsn"})
+	if err != nil {
+		t.Fatalf("NewTestDB with a registered DSN builder failed: %v", err)
+	}
+	defer CloseTestDB(db)
+
+	if err := ExecuteSQL(db, "CREATE TABLE custom (id INTEGER)"); err != nil {
+		t.Errorf("Failed to use database: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Encoder encodes request bodies and decodes response bodies of a media
+// type
+type Encoder interface {
+	Encode(v any) ([]byte, error)
+	Decode(data []byte, v any) error
+}
+
+// NewEncoder returns an Encoder from a marshal and an unmarshal function.
+// Most codecs fit as they are, e.g. for msgpack and CBOR:
+//
+//	RegisterEncoder("application/msgpack", NewEncoder(msgpack.Marshal, msgpack.Unmarshal))
+//	RegisterEncoder("application/cbor", NewEncoder(cbor.Marshal, cbor.Unmarshal))
+//
+// and for protobuf:
+//
+//	RegisterEncoder("application/x-protobuf", NewEncoder(
+//		func(v any) ([]byte, error) { return proto.Marshal(v.(proto.Message)) },
+//		func(data []byte, v any) error { return proto.Unmarshal(data, v.(proto.Message)) },
+//	))
+func NewEncoder(encode func(v any) ([]byte, error), decode func(data []byte, v any) error) Encoder {
+	return funcEncoder{encode: encode, decode: decode}
+}
+
+type funcEncoder struct {
+	encode func(v any) ([]byte, error)
+	decode func(data []byte, v any) error
+}
+
+func (e funcEncoder) Encode(v any) ([]byte, error) {
+	return e.encode(v)
+}
+
+func (e funcEncoder) Decode(data []byte, v any) error {
+	return e.decode(data, v)
+}
+
+// Built in encoders
+var (
+	// JSONEncoder encodes with encoding/json
+	JSONEncoder = NewEncoder(json.Marshal, json.Unmarshal)
+
+	// XMLEncoder encodes with encoding/xml
+	XMLEncoder = NewEncoder(xml.Marshal, xml.Unmarshal)
+
+	// BinaryEncoder encodes values implementing encoding.BinaryMarshaler
+	// or Marshal() ([]byte, error), as generated by some protobuf and
+	// msgpack code generators, and decodes into values implementing
+	// encoding.BinaryUnmarshaler or Unmarshal([]byte) error. []byte is
+	// passed through.
+	BinaryEncoder = NewEncoder(binaryEncode, binaryDecode)
+)
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]Encoder{
+		"application/json":         JSONEncoder,
+		"application/xml":          XMLEncoder,
+		"text/xml":                 XMLEncoder,
+		"application/octet-stream": BinaryEncoder,
+	}
+)
+
+// RegisterEncoder registers the encoder of a media type (e.g.
+// "application/x-protobuf"), replacing any encoder registered for it. A
+// nil encoder removes it. JSON, XML and application/octet-stream (with
+// BinaryEncoder) are built in.
+func RegisterEncoder(mediaType string, encoder Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	mediaType = strings.ToLower(mediaType)
+
+	if encoder == nil {
+		delete(encoders, mediaType)
+		return
+	}
+	encoders[mediaType] = encoder
+}
+
+// LookupEncoder returns the encoder of a Content-Type, ignoring its
+// parameters. Structured syntax suffixes fall back to their base type,
+// e.g. application/problem+json uses the application/json encoder.
+func LookupEncoder(contentType string) (Encoder, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	if encoder, ok := encoders[mediaType]; ok {
+		return encoder, true
+	}
+
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		encoder, ok := encoders["application/"+mediaType[i+1:]]
+		return encoder, ok
+	}
+
+	return nil, false
+}
+
+// EncodeBody encodes v with the encoder registered for contentType
+func EncodeBody(contentType string, v any) ([]byte, error) {
+	encoder, ok := LookupEncoder(contentType)
+	if !ok {
+		return nil, fmt.Errorf("no encoder registered for content type %q", contentType)
+	}
+
+	data, err := encoder.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s body: %w", contentType, err)
+	}
+
+	return data, nil
+}
+
+// DecodeBody decodes data into v with the encoder registered for
+// contentType
+func DecodeBody(contentType string, data []byte, v any) error {
+	encoder, ok := LookupEncoder(contentType)
+	if !ok {
+		return fmt.Errorf("no decoder registered for content type %q", contentType)
+	}
+
+	if err := encoder.Decode(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s body: %w", contentType, err)
+	}
+
+	return nil
+}
+
+// DecodeResponse decodes the response body into v with the encoder
+// registered for its Content-Type, e.g. the response of CallEndpoint or
+// of ResponseRecorder.Result()
+func DecodeResponse(response *http.Response, v any) error {
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return DecodeBody(response.Header.Get("Content-Type"), data, v)
+}
+
+// binaryEncode encodes the values supported by BinaryEncoder
+func binaryEncode(v any) ([]byte, error) {
+	switch value := v.(type) {
+	case []byte:
+		return value, nil
+	case encoding.BinaryMarshaler:
+		return value.MarshalBinary()
+	case interface{ Marshal() ([]byte, error) }:
+		return value.Marshal()
+	}
+
+	return nil, fmt.Errorf("%T does not implement encoding.BinaryMarshaler", v)
+}
+
+// binaryDecode decodes into the values supported by BinaryEncoder
+func binaryDecode(data []byte, v any) error {
+	switch value := v.(type) {
+	case *[]byte:
+		*value = append([]byte(nil), data...)
+		return nil
+	case encoding.BinaryUnmarshaler:
+		return value.UnmarshalBinary(data)
+	case interface{ Unmarshal([]byte) error }:
+		return value.Unmarshal(data)
+	}
+
+	return fmt.Errorf("%T does not implement encoding.BinaryUnmarshaler", v)
+}
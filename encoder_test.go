@@ -0,0 +1,149 @@
+package test
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type encoderOrder struct {
+	XMLName xml.Name `xml:"order" json:"-"`
+	ID      int      `xml:"id" json:"id"`
+	Item    string   `xml:"item" json:"item"`
+}
+
+// encoderPoint implements encoding.BinaryMarshaler and BinaryUnmarshaler
+type encoderPoint struct {
+	X, Y byte
+}
+
+func (p encoderPoint) MarshalBinary() ([]byte, error) {
+	return []byte{p.X, p.Y}, nil
+}
+
+func (p *encoderPoint) UnmarshalBinary(data []byte) error {
+	if len(data) != 2 {
+		return errors.New("expected 2 bytes")
+	}
+	p.X, p.Y = data[0], data[1]
+	return nil
+}
+
+// encoderEcho responds with the request body and Content-Type
+func encoderEcho(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	w.Write(body)
+}
+
+func TestNewRequestBodyDataXML(t *testing.T) {
+	body, response, err := CallEndpoint(http.MethodPost, encoderEcho, NewRequestOptions{
+		ContentType: "application/xml; charset=utf-8",
+		BodyData:    encoderOrder{ID: 7, Item: "book"},
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	if body != "<order><id>7</id><item>book</item></order>" {
+		t.Errorf("Expected the XML body, got %q", body)
+	}
+
+	var order encoderOrder
+	if err := DecodeResponse(response, &order); err != nil {
+		t.Fatalf("DecodeResponse failed: %v", err)
+	}
+	if order.ID != 7 || order.Item != "book" {
+		t.Errorf("Expected the decoded order, got %+v", order)
+	}
+}
+
+func TestNewRequestBodyDataBinary(t *testing.T) {
+	body, response, err := CallEndpoint(http.MethodPost, encoderEcho, NewRequestOptions{
+		ContentType: "application/octet-stream",
+		BodyData:    encoderPoint{X: 3, Y: 4},
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	if body != "\x03\x04" {
+		t.Errorf("Expected the binary body, got %q", body)
+	}
+
+	var point encoderPoint
+	if err := DecodeResponse(response, &point); err != nil {
+		t.Fatalf("DecodeResponse failed: %v", err)
+	}
+	if point != (encoderPoint{X: 3, Y: 4}) {
+		t.Errorf("Expected the decoded point, got %+v", point)
+	}
+
+	if _, err := EncodeBody("application/octet-stream", encoderOrder{}); err == nil {
+		t.Error("Expected an error for a value without a binary marshaler")
+	}
+}
+
+func TestNewRequestBodyDataErrors(t *testing.T) {
+	if _, err := NewRequest(http.MethodPost, "/", NewRequestOptions{BodyData: 1}); err == nil {
+		t.Error("Expected an error for BodyData without a ContentType")
+	}
+
+	_, err := NewRequest(http.MethodPost, "/", NewRequestOptions{ContentType: "application/x-unknown", BodyData: 1})
+	if err == nil || !strings.Contains(err.Error(), "no encoder registered") {
+		t.Errorf("Expected an error for an unknown content type, got %v", err)
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	// A toy codec upper casing strings
+	RegisterEncoder("Application/X-Upper", NewEncoder(
+		func(v any) ([]byte, error) { return []byte(strings.ToUpper(v.(string))), nil },
+		func(data []byte, v any) error { *v.(*string) = strings.ToLower(string(data)); return nil },
+	))
+	defer RegisterEncoder("application/x-upper", nil)
+
+	recorder := NewTestHTTPRequest(http.MethodPost, "/").
+		WithEncodedBody("application/x-upper", "hello").
+		Execute(http.HandlerFunc(encoderEcho))
+
+	if recorder.Body.String() != "HELLO" {
+		t.Errorf("Expected the encoded body, got %q", recorder.Body.String())
+	}
+
+	var decoded string
+	if err := DecodeResponse(recorder.Result(), &decoded); err != nil {
+		t.Fatalf("DecodeResponse failed: %v", err)
+	}
+	if decoded != "hello" {
+		t.Errorf("Expected the decoded body, got %q", decoded)
+	}
+
+	RegisterEncoder("application/x-upper", nil)
+	if _, ok := LookupEncoder("application/x-upper"); ok {
+		t.Error("Expected the encoder to be removed")
+	}
+}
+
+func TestLookupEncoderSuffix(t *testing.T) {
+	var problem struct {
+		Title string `json:"title"`
+	}
+
+	if err := DecodeBody("application/problem+json", []byte(`{"title":"Not Found"}`), &problem); err != nil {
+		t.Fatalf("DecodeBody failed: %v", err)
+	}
+	if problem.Title != "Not Found" {
+		t.Errorf("Expected the problem title, got %q", problem.Title)
+	}
+
+	if _, ok := LookupEncoder("application/atom+xml"); !ok {
+		t.Error("Expected application/atom+xml to use the XML encoder")
+	}
+	if _, ok := LookupEncoder("text/plain"); ok {
+		t.Error("Expected no encoder for text/plain")
+	}
+}
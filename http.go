@@ -1,10 +1,15 @@
 package test
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"testing"
 )
 
 // TestHTTPRequest represents a test HTTP request
@@ -13,6 +18,20 @@ type TestHTTPRequest struct {
 	Path    string
 	Body    io.Reader
 	Headers map[string]string
+	Cookies []*http.Cookie
+
+	// PathValues sets the route parameters, see NewRequestOptions.PathValues
+	PathValues map[string]string
+
+	// Multipart sets the body as multipart/form-data, replacing Body
+	Multipart *MultipartBody
+
+	// Connection properties, see the fields of NewRequestOptions
+	RemoteAddr string
+	Host       string
+	Proto      string
+	TLS        *tls.ConnectionState
+	Proxy      *ProxyChain
 }
 
 // NewTestHTTPRequest creates a new test HTTP request
@@ -36,6 +55,68 @@ func (r *TestHTTPRequest) WithHeader(key, value string) *TestHTTPRequest {
 	return r
 }
 
+// WithCookie adds a cookie to the request
+func (r *TestHTTPRequest) WithCookie(cookie *http.Cookie) *TestHTTPRequest {
+	r.Cookies = append(r.Cookies, cookie)
+	return r
+}
+
+// WithBasicAuth sets the Authorization header for HTTP Basic authentication
+func (r *TestHTTPRequest) WithBasicAuth(username, password string) *TestHTTPRequest {
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	r.Headers["Authorization"] = "Basic " + credentials
+	return r
+}
+
+// WithBearerToken sets the Authorization header to "Bearer <token>", e.g.
+// with a token minted by a JWTSigner
+func (r *TestHTTPRequest) WithBearerToken(token string) *TestHTTPRequest {
+	r.Headers["Authorization"] = "Bearer " + token
+	return r
+}
+
+// WithPathValue sets a route parameter read with r.PathValue and by the
+// routers registered with RegisterPathValueAdapter
+func (r *TestHTTPRequest) WithPathValue(key, value string) *TestHTTPRequest {
+	if r.PathValues == nil {
+		r.PathValues = map[string]string{}
+	}
+	r.PathValues[key] = value
+	return r
+}
+
+// WithRemoteAddr sets the client IP and port, port 1234 is used for a
+// bare IP
+func (r *TestHTTPRequest) WithRemoteAddr(remoteAddr string) *TestHTTPRequest {
+	r.RemoteAddr = remoteAddr
+	return r
+}
+
+// WithHost sets the Host header the request was sent with
+func (r *TestHTTPRequest) WithHost(host string) *TestHTTPRequest {
+	r.Host = host
+	return r
+}
+
+// WithProto sets the protocol version (e.g. "HTTP/2.0")
+func (r *TestHTTPRequest) WithProto(proto string) *TestHTTPRequest {
+	r.Proto = proto
+	return r
+}
+
+// WithTLS simulates an HTTPS request, see NewTLSConnectionState
+func (r *TestHTTPRequest) WithTLS(state *tls.ConnectionState) *TestHTTPRequest {
+	r.TLS = state
+	return r
+}
+
+// WithProxy adds the Forwarded or X-Forwarded-* headers of a proxy chain
+// and sets the remote address to the last proxy
+func (r *TestHTTPRequest) WithProxy(proxy *ProxyChain) *TestHTTPRequest {
+	r.Proxy = proxy
+	return r
+}
+
 // WithJSONBody sets the request body as JSON and adds the appropriate content type header
 func (r *TestHTTPRequest) WithJSONBody(jsonBody string) *TestHTTPRequest {
 	r.Body = strings.NewReader(jsonBody)
@@ -43,6 +124,20 @@ func (r *TestHTTPRequest) WithJSONBody(jsonBody string) *TestHTTPRequest {
 	return r
 }
 
+// WithEncodedBody sets the request body to v encoded with the Encoder
+// registered for contentType and sets the Content-Type header. Like
+// httptest.NewRequest, it panics if v cannot be encoded.
+func (r *TestHTTPRequest) WithEncodedBody(contentType string, v any) *TestHTTPRequest {
+	data, err := EncodeBody(contentType, v)
+	if err != nil {
+		panic("invalid body: " + err.Error())
+	}
+
+	r.Body = bytes.NewReader(data)
+	r.Headers["Content-Type"] = contentType
+	return r
+}
+
 // WithFormBody sets the request body as form data and adds the appropriate content type header
 func (r *TestHTTPRequest) WithFormBody(formBody string) *TestHTTPRequest {
 	r.Body = strings.NewReader(formBody)
@@ -50,14 +145,41 @@ func (r *TestHTTPRequest) WithFormBody(formBody string) *TestHTTPRequest {
 	return r
 }
 
-// Execute executes the request against the provided handler
-func (r *TestHTTPRequest) Execute(handler http.Handler) *httptest.ResponseRecorder {
-	req := httptest.NewRequest(r.Method, r.Path, r.Body)
+// WithMultipart sets the request body as multipart/form-data, the
+// Content-Type header with its boundary is set when the request is executed
+func (r *TestHTTPRequest) WithMultipart(body *MultipartBody) *TestHTTPRequest {
+	r.Multipart = body
+	return r
+}
 
-	// Set headers
-	for key, value := range r.Headers {
-		req.Header.Set(key, value)
+// WithMultipartField adds a text field to the multipart/form-data body
+func (r *TestHTTPRequest) WithMultipartField(name, value string) *TestHTTPRequest {
+	if r.Multipart == nil {
+		r.Multipart = &MultipartBody{}
 	}
+	if r.Multipart.Fields == nil {
+		r.Multipart.Fields = url.Values{}
+	}
+	r.Multipart.Fields.Add(name, value)
+	return r
+}
+
+// WithMultipartFile adds a file to the multipart/form-data body
+func (r *TestHTTPRequest) WithMultipartFile(file MultipartFile) *TestHTTPRequest {
+	if r.Multipart == nil {
+		r.Multipart = &MultipartBody{}
+	}
+	r.Multipart.Files = append(r.Multipart.Files, file)
+	return r
+}
+
+// Execute executes the request against the provided handler. Like
+// httptest.NewRequest, it panics if the request cannot be built.
+func (r *TestHTTPRequest) Execute(handler http.Handler) *httptest.ResponseRecorder {
+	req := r.build()
+
+	// Release a streamed body the handler did not read, as servers do
+	defer req.Body.Close()
 
 	// Create a response recorder
 	recorder := httptest.NewRecorder()
@@ -68,6 +190,72 @@ func (r *TestHTTPRequest) Execute(handler http.Handler) *httptest.ResponseRecord
 	return recorder
 }
 
+// ExecuteT is like Execute but logs the request as a curl command and a raw
+// HTTP dump if the test fails, see LogRequestOnFailure
+func (r *TestHTTPRequest) ExecuteT(t testing.TB, handler http.Handler) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := r.build()
+	defer req.Body.Close()
+
+	LogRequestOnFailure(t, req)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+// build creates the *http.Request, panicking if it cannot be built
+func (r *TestHTTPRequest) build() *http.Request {
+	conn := connection{
+		remoteAddr: r.RemoteAddr,
+		host:       r.Host,
+		proto:      r.Proto,
+		tls:        r.TLS,
+		proxy:      r.Proxy,
+	}
+
+	// Checked before a streamed body is started
+	if err := conn.validate(); err != nil {
+		panic("invalid connection: " + err.Error())
+	}
+
+	body := r.Body
+	contentType := ""
+
+	if r.Multipart != nil {
+		var err error
+		body, contentType, err = r.Multipart.Reader()
+		if err != nil {
+			panic("invalid multipart body: " + err.Error())
+		}
+	}
+
+	req := httptest.NewRequest(r.Method, r.Path, body)
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	// Set headers
+	for key, value := range r.Headers {
+		req.Header.Set(key, value)
+	}
+
+	for _, cookie := range r.Cookies {
+		req.AddCookie(cookie)
+	}
+
+	conn.apply(req)
+
+	if r.PathValues != nil {
+		req = applyPathValues(req, r.PathValues)
+	}
+
+	return req
+}
+
 // TestHTTPServer is a wrapper around httptest.Server for testing HTTP servers
 type TestHTTPServer struct {
 	Server *httptest.Server
@@ -0,0 +1,492 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	urlpkg "net/url"
+)
+
+// maxVariableDepth limits how deep variables referencing other variables
+// are resolved, catching cycles
+const maxVariableDepth = 10
+
+// httpFilePlaceholder matches {{name}} placeholders
+var httpFilePlaceholder = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// httpFileMethods are the methods recognized at the start of a request line
+var httpFileMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// HTTPFileOptions configures ParseHTTPFile and ParseHTTPRequests
+type HTTPFileOptions struct {
+	// Config resolves {{placeholders}} named after the environment
+	// variables of the configuration (e.g. {{APP_URL}}), see
+	// SetupTestEnvironment
+	Config *TestConfig
+
+	// Variables resolve {{placeholders}}, taking precedence over the
+	// variables of the file and Config
+	Variables map[string]string
+}
+
+// HTTPFileRequest is a request parsed from a .http file or a raw HTTP
+// request, with its placeholders resolved
+type HTTPFileRequest struct {
+	// Name is set with "# @name" or the text after the "###" separator,
+	// and defaults to the method and URL
+	Name string
+
+	Method string
+
+	// URL is the URL of the request line, made absolute with the Host
+	// header of raw HTTP requests
+	URL string
+
+	Headers map[string]string
+	Body    string
+
+	// Line is the line of the request line, starting at 1
+	Line int
+}
+
+// NewRequestOptions returns options calling the request with CallEndpoint
+// or NewRequest. The options have no method, so pass r.Method along:
+//
+//	CallEndpoint(r.Method, handler, r.NewRequestOptions())
+func (r HTTPFileRequest) NewRequestOptions() NewRequestOptions {
+	headers := map[string]string{}
+	for key, value := range r.Headers {
+		headers[key] = value
+	}
+
+	return NewRequestOptions{
+		URL:     r.URL,
+		Headers: headers,
+		Body:    r.Body,
+	}
+}
+
+// TestHTTPRequest returns the request as a *TestHTTPRequest
+func (r HTTPFileRequest) TestHTTPRequest() *TestHTTPRequest {
+	req := NewTestHTTPRequest(r.Method, r.URL)
+	for key, value := range r.Headers {
+		req.WithHeader(key, value)
+	}
+	if r.Body != "" {
+		req.WithBody(r.Body)
+	}
+	return req
+}
+
+// ParseHTTPFile parses the requests of a .http (REST Client) file
+func ParseHTTPFile(path string, opts *HTTPFileOptions) ([]HTTPFileRequest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP file: %w", err)
+	}
+
+	requests, err := ParseHTTPRequests(string(content), opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return requests, nil
+}
+
+// ParseHTTPRequests parses requests in the .http (REST Client) format,
+// which also covers raw HTTP/1.1 requests. Requests are separated by lines
+// starting with "###" and made of a request line ("GET /path HTTP/1.1" or
+// just the URL for GET), query lines starting with "?" or "&", headers, a
+// blank line and the body. Lines starting with "#" or "//" are comments,
+// "@name = value" lines define variables and {{name}} placeholders are
+// resolved from the options, the variables and the configuration.
+//
+// As in REST Client, a line starting with "###" always ends the request,
+// also inside a body, so a body with such lines (e.g. Markdown headings)
+// cannot be written inline.
+func ParseHTTPRequests(text string, opts *HTTPFileOptions) ([]HTTPFileRequest, error) {
+	if opts == nil {
+		opts = &HTTPFileOptions{}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	// Split the lines into blocks at the separators
+	blocks := [][]string{}
+	offsets := []int{}
+	start := 0
+	for i := 1; i <= len(lines); i++ {
+		if i == len(lines) || strings.HasPrefix(lines[i], "###") {
+			blocks = append(blocks, lines[start:i])
+			offsets = append(offsets, start)
+			start = i
+		}
+	}
+
+	resolver := &httpFileResolver{opts: opts, variables: map[string]string{}}
+	if opts.Config != nil {
+		resolver.config = opts.Config.envVars()
+	}
+
+	// Variables may be used before they are defined
+	for _, block := range blocks {
+		for _, line := range httpFilePreamble(block) {
+			if name, value, ok := httpFileVariable(line); ok {
+				resolver.variables[name] = value
+			}
+		}
+	}
+
+	requests := []HTTPFileRequest{}
+	for i, block := range blocks {
+		request, ok, err := parseHTTPFileBlock(block, offsets[i], resolver)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests, nil
+}
+
+// httpFilePreamble returns the lines of a block before its request line:
+// the separator, comments, variables and blank lines
+func httpFilePreamble(lines []string) []string {
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if i == 0 && strings.HasPrefix(line, "###") {
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		if _, _, ok := httpFileVariable(line); ok {
+			continue
+		}
+		if _, ok := httpFileComment(line); ok {
+			continue
+		}
+
+		return lines[:i]
+	}
+	return lines
+}
+
+// parseHTTPFileBlock parses the lines of a request, the first line being
+// the "###" separator unless the block starts the file
+func parseHTTPFileBlock(lines []string, offset int, resolver *httpFileResolver) (HTTPFileRequest, bool, error) {
+	request := HTTPFileRequest{Headers: map[string]string{}}
+
+	preamble := httpFilePreamble(lines)
+	for i, line := range preamble {
+		line = strings.TrimSpace(line)
+
+		if i == 0 && strings.HasPrefix(line, "###") {
+			request.Name = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		}
+
+		if comment, ok := httpFileComment(line); ok {
+			if name, ok := strings.CutPrefix(comment, "@name"); ok && strings.TrimSpace(name) != "" {
+				request.Name = strings.TrimSpace(name)
+			}
+		}
+	}
+
+	i := len(preamble)
+	if i == len(lines) {
+		return request, false, nil
+	}
+
+	request.Line = offset + i + 1
+	fields := strings.Fields(lines[i])
+
+	if len(fields) > 1 && httpFileMethods[fields[0]] {
+		request.Method = fields[0]
+		fields = fields[1:]
+	} else {
+		request.Method = http.MethodGet
+	}
+
+	if len(fields) > 1 && strings.HasPrefix(fields[len(fields)-1], "HTTP/") {
+		fields = fields[:len(fields)-1]
+	}
+
+	rawURL := strings.Join(fields, " ")
+	i++
+
+	// Query lines continue the URL
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "?") && !strings.HasPrefix(line, "&") {
+			break
+		}
+		rawURL += line
+	}
+
+	var err error
+	if request.URL, err = resolver.resolve(rawURL, request.Line); err != nil {
+		return request, false, err
+	}
+
+	// Headers up to the first blank line
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			i++
+			break
+		}
+
+		if _, ok := httpFileComment(line); ok {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return request, false, fmt.Errorf("line %d: invalid header %q", offset+i+1, line)
+		}
+
+		value, err = resolver.resolve(strings.TrimSpace(value), offset+i+1)
+		if err != nil {
+			return request, false, err
+		}
+		request.Headers[http.CanonicalHeaderKey(strings.TrimSpace(key))] = value
+	}
+
+	// The rest is the body, without trailing blank lines
+	body := lines[min(i, len(lines)):]
+	for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+		body = body[:len(body)-1]
+	}
+
+	if request.Body, err = resolver.resolve(strings.Join(body, "\n"), offset+i+1); err != nil {
+		return request, false, err
+	}
+
+	// Raw requests name the host in a header
+	if host, ok := request.Headers["Host"]; ok && strings.HasPrefix(request.URL, "/") {
+		request.URL = "http://" + host + request.URL
+		delete(request.Headers, "Host")
+	}
+
+	if request.Name == "" {
+		request.Name = request.Method + " " + request.URL
+	}
+
+	return request, true, nil
+}
+
+// httpFileVariable parses a "@name = value" variable definition
+func httpFileVariable(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "@") {
+		return "", "", false
+	}
+
+	name, value, ok := strings.Cut(line[1:], "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", false
+	}
+
+	return name, strings.TrimSpace(value), true
+}
+
+// httpFileComment returns the text of a "#" or "//" comment line
+func httpFileComment(line string) (string, bool) {
+	if comment, ok := strings.CutPrefix(line, "//"); ok {
+		return strings.TrimSpace(comment), true
+	}
+	if comment, ok := strings.CutPrefix(line, "#"); ok {
+		return strings.TrimSpace(comment), true
+	}
+	return "", false
+}
+
+// httpFileResolver resolves {{placeholders}}
+type httpFileResolver struct {
+	opts      *HTTPFileOptions
+	variables map[string]string
+	config    map[string]string
+}
+
+// resolve replaces the placeholders of s, reporting unknown variables
+// with the line they are used on
+func (r *httpFileResolver) resolve(s string, line int) (string, error) {
+	return r.resolveDepth(s, line, 0)
+}
+
+// resolveDepth resolves placeholders, including those in the values of
+// variables, up to maxVariableDepth levels
+func (r *httpFileResolver) resolveDepth(s string, line int, depth int) (string, error) {
+	if depth > maxVariableDepth {
+		return "", fmt.Errorf("line %d: variables nested more than %d levels, is there a cycle?", line, maxVariableDepth)
+	}
+
+	var err error
+	resolved := httpFilePlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		if err != nil {
+			return placeholder
+		}
+
+		name := httpFilePlaceholder.FindStringSubmatch(placeholder)[1]
+
+		value, ok := r.opts.Variables[name]
+		if !ok {
+			value, ok = r.variables[name]
+		}
+		if !ok {
+			value, ok = r.config[name]
+		}
+		if !ok {
+			err = fmt.Errorf("line %d: unknown variable %s", line, placeholder)
+			return placeholder
+		}
+
+		value, err = r.resolveDepth(value, line, depth+1)
+		return value
+	})
+
+	return resolved, err
+}
+
+// HTTPFileResult is the response to a request run by an HTTPFileRunner
+type HTTPFileResult struct {
+	Request  HTTPFileRequest
+	Response *http.Response
+	Body     string
+}
+
+// HTTPFileRunner executes parsed requests as subtests, so documented
+// examples double as tests. Cookies set by responses are sent with the
+// following requests, like a REST client does.
+type HTTPFileRunner struct {
+	// Handler serves the requests in-process
+	Handler http.Handler
+
+	// Server serves the requests if Handler is nil. The scheme and host of
+	// absolute URLs are replaced with those of the server.
+	Server *TestHTTPServer
+
+	// Check validates each response, failing the subtest on errors.
+	// Defaults to failing on 5xx status codes.
+	Check func(t testing.TB, result *HTTPFileResult)
+}
+
+// RunHTTPFile parses a .http file and runs its requests against the
+// handler as subtests named after the requests
+func RunHTTPFile(t *testing.T, path string, handler http.Handler, opts *HTTPFileOptions) []*HTTPFileResult {
+	t.Helper()
+
+	requests, err := ParseHTTPFile(path, opts)
+	if err != nil {
+		t.Fatalf("failed to parse HTTP file: %v", err)
+	}
+
+	runner := &HTTPFileRunner{Handler: handler}
+	return runner.Run(t, requests)
+}
+
+// Run executes the requests in order, each in a subtest, and returns
+// their results. Requests whose subtest failed to execute have no result.
+func (r *HTTPFileRunner) Run(t *testing.T, requests []HTTPFileRequest) []*HTTPFileResult {
+	t.Helper()
+
+	check := r.Check
+	if check == nil {
+		check = checkNoServerError
+	}
+
+	session := NewTestSession()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	results := []*HTTPFileResult{}
+	for _, request := range requests {
+		t.Run(request.Name, func(t *testing.T) {
+			result := &HTTPFileResult{Request: request}
+
+			if r.Handler != nil {
+				recorder := session.ExecuteT(t, request.TestHTTPRequest(), r.Handler)
+				result.Response = recorder.Result()
+				result.Body = recorder.Body.String()
+			} else {
+				response, body, err := r.do(client, request)
+				if err != nil {
+					t.Fatalf("%s (line %d): %v", request.Name, request.Line, err)
+				}
+				result.Response = response
+				result.Body = body
+			}
+
+			results = append(results, result)
+			check(t, result)
+		})
+	}
+
+	return results
+}
+
+// do sends the request to the server
+func (r *HTTPFileRunner) do(client *http.Client, request HTTPFileRequest) (*http.Response, string, error) {
+	if r.Server == nil {
+		return nil, "", fmt.Errorf("HTTPFileRunner needs a Handler or a Server")
+	}
+
+	u, err := urlpkg.Parse(request.URL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	server, err := urlpkg.Parse(r.Server.URL())
+	if err != nil {
+		return nil, "", err
+	}
+
+	u.Scheme = server.Scheme
+	u.Host = server.Host
+
+	req, err := http.NewRequest(request.Method, u.String(), strings.NewReader(request.Body))
+	if err != nil {
+		return nil, "", err
+	}
+
+	for key, value := range request.Headers {
+		req.Header.Set(key, value)
+	}
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return response, string(body), nil
+}
+
+// checkNoServerError fails the test on 5xx status codes
+func checkNoServerError(t testing.TB, result *HTTPFileResult) {
+	t.Helper()
+
+	if result.Response.StatusCode >= 500 {
+		t.Errorf("%s (line %d): status %d: %s", result.Request.Name, result.Request.Line, result.Response.StatusCode, result.Body)
+	}
+}
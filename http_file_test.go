@@ -0,0 +1,198 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const httpFileTestContent = `@baseUrl = {{APP_URL}}/api
+@token = secret
+
+### Create a user
+POST {{baseUrl}}/users HTTP/1.1
+Content-Type: application/json
+Authorization: Bearer {{token}}
+
+{"name": "{{name}}"}
+
+###
+# @name listUsers
+GET {{baseUrl}}/users
+    ?page=2
+    &sort=name
+Accept: application/json
+
+###
+// Only comments, no request
+
+### Raw request
+DELETE /api/users/1 HTTP/1.1
+Host: example.com
+
+`
+
+func TestParseHTTPRequests(t *testing.T) {
+	config := DefaultTestConfig()
+
+	requests, err := ParseHTTPRequests(httpFileTestContent, &HTTPFileOptions{
+		Config:    config,
+		Variables: map[string]string{"name": "Ada"},
+	})
+	if err != nil {
+		t.Fatalf("ParseHTTPRequests failed: %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(requests))
+	}
+
+	create := requests[0]
+	if create.Name != "Create a user" || create.Method != http.MethodPost || create.Line != 5 {
+		t.Errorf("Expected POST request \"Create a user\" on line 5, got %s %q on line %d", create.Method, create.Name, create.Line)
+	}
+	if create.URL != "http://localhost:8080/api/users" {
+		t.Errorf("Expected URL from the config, got %q", create.URL)
+	}
+	if create.Headers["Authorization"] != "Bearer secret" {
+		t.Errorf("Expected Authorization from the variable, got %q", create.Headers["Authorization"])
+	}
+	if create.Body != `{"name": "Ada"}` {
+		t.Errorf("Expected body with the option variable, got %q", create.Body)
+	}
+
+	list := requests[1]
+	if list.Name != "listUsers" || list.Method != http.MethodGet {
+		t.Errorf("Expected GET request \"listUsers\", got %s %q", list.Method, list.Name)
+	}
+	if list.URL != "http://localhost:8080/api/users?page=2&sort=name" {
+		t.Errorf("Expected URL with the query lines, got %q", list.URL)
+	}
+	if list.Body != "" {
+		t.Errorf("Expected no body, got %q", list.Body)
+	}
+
+	raw := requests[2]
+	if raw.URL != "http://example.com/api/users/1" {
+		t.Errorf("Expected URL with the Host header, got %q", raw.URL)
+	}
+	if _, ok := raw.Headers["Host"]; ok {
+		t.Error("Expected the Host header to move into the URL")
+	}
+}
+
+func TestParseHTTPRequestsUnknownVariable(t *testing.T) {
+	_, err := ParseHTTPRequests("GET /users/{{id}}", nil)
+	if err == nil || !strings.Contains(err.Error(), "line 1: unknown variable {{id}}") {
+		t.Errorf("Expected an unknown variable error, got %v", err)
+	}
+
+	_, err = ParseHTTPRequests("@a = {{b}}\n@b = {{a}}\nGET /{{a}}", nil)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+}
+
+func TestHTTPFileRequestNewRequestOptions(t *testing.T) {
+	requests, err := ParseHTTPRequests("PUT /items/1?draft=true\nContent-Type: text/plain\n\nhello", nil)
+	if err != nil {
+		t.Fatalf("ParseHTTPRequests failed: %v", err)
+	}
+
+	request := requests[0]
+	body, _, err := CallEndpoint(request.Method, func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + r.URL.String() + " " + r.Header.Get("Content-Type") + " " + string(content)))
+	}, request.NewRequestOptions())
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	if body != "PUT /items/1?draft=true text/plain hello" {
+		t.Errorf("Expected the parsed request, got %q", body)
+	}
+}
+
+// httpFileTestHandler serves the requests of httpFileTestContent, keeping
+// the session in a cookie
+func httpFileTestHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "1", Path: "/"})
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("GET /api/users", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.Error(w, "no session", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(r.URL.Query().Get("page")))
+	})
+	mux.HandleFunc("DELETE /api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func TestRunHTTPFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.http")
+	if err := os.WriteFile(path, []byte(httpFileTestContent), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	results := RunHTTPFile(t, path, httpFileTestHandler(), &HTTPFileOptions{
+		Config:    DefaultTestConfig(),
+		Variables: map[string]string{"name": "Ada"},
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	expected := []int{http.StatusCreated, http.StatusOK, http.StatusNoContent}
+	for i, result := range results {
+		if result.Response.StatusCode != expected[i] {
+			t.Errorf("%s: expected status code %d, got %d: %s", result.Request.Name, expected[i], result.Response.StatusCode, result.Body)
+		}
+	}
+
+	// The cookie of the first response is sent with the second request
+	if results[1].Body != "2" {
+		t.Errorf("Expected page 2, got %q", results[1].Body)
+	}
+}
+
+func TestHTTPFileRunnerServer(t *testing.T) {
+	server := NewTestHTTPServer(httpFileTestHandler())
+	defer server.Close()
+
+	requests, err := ParseHTTPRequests(httpFileTestContent, &HTTPFileOptions{
+		Config:    DefaultTestConfig(),
+		Variables: map[string]string{"name": "Ada"},
+	})
+	if err != nil {
+		t.Fatalf("ParseHTTPRequests failed: %v", err)
+	}
+
+	checked := 0
+	runner := &HTTPFileRunner{
+		Server: server,
+		Check: func(t testing.TB, result *HTTPFileResult) {
+			checked++
+			if result.Response.StatusCode >= 400 {
+				t.Errorf("%s: status %d: %s", result.Request.Name, result.Response.StatusCode, result.Body)
+			}
+		},
+	}
+
+	results := runner.Run(t, requests)
+	if len(results) != 3 || checked != 3 {
+		t.Fatalf("Expected 3 checked results, got %d results and %d checks", len(results), checked)
+	}
+	if results[1].Body != "2" {
+		t.Errorf("Expected page 2, got %q", results[1].Body)
+	}
+}
@@ -0,0 +1,165 @@
+package test
+
+import (
+	"database/sql"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kinds of database resources tracked for leaks
+const (
+	leakKindRows = "rows"
+	leakKindStmt = "stmt"
+	leakKindTx   = "tx"
+)
+
+// dbTrackers holds the leak tracker of each database opened by NewTestDB
+// with DetectLeaks enabled
+var dbTrackers sync.Map
+
+// Leak is a database resource that was still open when the test database
+// was closed
+type Leak struct {
+	// Kind is "rows", "stmt" or "tx"
+	Kind string
+
+	// Query is the SQL the rows or statement belong to, if known
+	Query string
+
+	// Stack is the stack trace of the code that created the resource
+	Stack string
+}
+
+// LeakError is returned by CloseTestDB when the database was opened with
+// DetectLeaks and resources were left open
+type LeakError struct {
+	Leaks []Leak
+
+	// InUse is the number of connections still in use (see sql.DBStats),
+	// which also counts connections leaked through db.Conn
+	InUse int
+}
+
+// Error describes every leaked resource together with where it was created
+func (e *LeakError) Error() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "test database closed with %d leaked resource(s) and %d connection(s) in use", len(e.Leaks), e.InUse)
+
+	for _, leak := range e.Leaks {
+		fmt.Fprintf(&b, "\n\nunclosed %s", leak.Kind)
+		if leak.Query != "" {
+			fmt.Fprintf(&b, " for query: %s", leak.Query)
+		}
+		fmt.Fprintf(&b, "\ncreated at:\n%s", leak.Stack)
+	}
+
+	return b.String()
+}
+
+type trackedResource struct {
+	kind  string
+	query string
+	stack []uintptr
+}
+
+// leakTracker records the rows, statements and transactions opened through
+// a tracked driver until they are closed
+type leakTracker struct {
+	mu     sync.Mutex
+	nextID uint64
+	open   map[uint64]trackedResource
+}
+
+func newLeakTracker() *leakTracker {
+	return &leakTracker{open: map[uint64]trackedResource{}}
+}
+
+// track records an open resource. A nil tracker tracks nothing.
+func (l *leakTracker) track(kind string, query string) uint64 {
+	if l == nil {
+		return 0
+	}
+
+	stack := make([]uintptr, 64)
+	stack = stack[:runtime.Callers(3, stack)]
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.nextID++
+	l.open[l.nextID] = trackedResource{kind: kind, query: query, stack: stack}
+	return l.nextID
+}
+
+func (l *leakTracker) release(id uint64) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.open, id)
+}
+
+// leaks returns the resources still open, in the order they were created
+func (l *leakTracker) leaks() []Leak {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ids := make([]uint64, 0, len(l.open))
+	for id := range l.open {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	leaks := []Leak{}
+	for _, id := range ids {
+		resource := l.open[id]
+		leaks = append(leaks, Leak{
+			Kind:  resource.kind,
+			Query: resource.query,
+			Stack: formatStack(resource.stack),
+		})
+	}
+
+	return leaks
+}
+
+// check returns a LeakError if any resource or connection is still in use
+func (l *leakTracker) check(db *sql.DB) error {
+	leaks := l.leaks()
+	inUse := db.Stats().InUse
+
+	if len(leaks) == 0 && inUse == 0 {
+		return nil
+	}
+
+	return &LeakError{Leaks: leaks, InUse: inUse}
+}
+
+// formatStack renders a stack trace, leaving out the database/sql and
+// tracking frames so the first frame shown is the code that opened the
+// resource
+func formatStack(stack []uintptr) string {
+	var b strings.Builder
+
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+
+		if !strings.HasPrefix(frame.Function, "database/sql.") && !strings.HasPrefix(frame.Function, "runtime.") {
+			fmt.Fprintf(&b, "\t%s\n\t\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCloseTestDBReportsLeaks(t *testing.T) {
+	db, err := NewTestDB(&DBConfig{
+		Driver:      "sqlite",
+		Database:    "file:leaks?mode=memory&cache=shared",
+		DetectLeaks: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	if err := CreateTestTable(db, "leaks", "id INTEGER PRIMARY KEY, name TEXT"); err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+	if err := ExecuteSQLWithArgs(db, "INSERT INTO leaks (name) VALUES (?), (?)", "a", "b"); err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	// Fully iterated rows and committed transactions are not leaks
+	rows, err := db.Query("SELECT name FROM leaks")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	for rows.Next() {
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	// Leak one of each
+	leakedRows, err := db.Query("SELECT name FROM leaks WHERE id > ?", 0)
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	leakedRows.Next()
+
+	leakedTx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+
+	leakedStmt, err := db.Prepare("SELECT id FROM leaks")
+	if err != nil {
+		t.Fatalf("Failed to prepare: %v", err)
+	}
+
+	// Release the leaks afterwards, they would lock the shared database
+	// for the next run (-count)
+	defer func() {
+		leakedRows.Close()
+		leakedTx.Rollback()
+		leakedStmt.Close()
+	}()
+
+	err = CloseTestDB(db)
+
+	var leakErr *LeakError
+	if !errors.As(err, &leakErr) {
+		t.Fatalf("Expected a *LeakError, got %v", err)
+	}
+
+	kinds := map[string]int{}
+	for _, leak := range leakErr.Leaks {
+		kinds[leak.Kind]++
+		if !strings.Contains(leak.Stack, "TestCloseTestDBReportsLeaks") {
+			t.Errorf("Expected the %s stack to point at the test, got:\n%s", leak.Kind, leak.Stack)
+		}
+	}
+
+	if kinds[leakKindRows] != 1 || kinds[leakKindTx] != 1 || kinds[leakKindStmt] < 1 {
+		t.Errorf("Expected a leaked rows, tx and stmt, got %v", kinds)
+	}
+
+	if !strings.Contains(err.Error(), "SELECT name FROM leaks WHERE id > ?") {
+		t.Errorf("Expected the error to name the leaked query, got:\n%s", err.Error())
+	}
+}
+
+func TestCloseTestDBWithoutLeaks(t *testing.T) {
+	db, err := NewTestDB(&DBConfig{
+		Driver:      "sqlite",
+		Database:    "file:noleaks?mode=memory&cache=shared",
+		DetectLeaks: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	var one int
+	if err := db.QueryRow("SELECT 1").Scan(&one); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+
+	stmt, err := db.Prepare("SELECT ?")
+	if err != nil {
+		t.Fatalf("Failed to prepare: %v", err)
+	}
+	if err := stmt.QueryRow(1).Scan(&one); err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	stmt.Close()
+
+	if err := CloseTestDB(db); err != nil {
+		t.Errorf("Expected no leaks, got %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	urlpkg "net/url"
+)
+
+// MultipartBody is a multipart/form-data request body with text fields and
+// files. Files read from a reader or a path are streamed, so large uploads
+// are not buffered in memory.
+type MultipartBody struct {
+	// Fields are the text fields, written first in sorted order
+	Fields urlpkg.Values
+
+	// Files are the file parts, written after the fields in order
+	Files []MultipartFile
+
+	// Boundary sets the part boundary, random if empty
+	Boundary string
+}
+
+// MultipartFile is a file part of a multipart/form-data body. Its content
+// comes from Content, Reader or Path, in that order of precedence. A part
+// without a Reader or Path is in-memory, and nil Content is an empty file.
+type MultipartFile struct {
+	// FieldName is the form field name
+	FieldName string
+
+	// FileName is the file name sent to the server, defaults to the base
+	// name of Path
+	FileName string
+
+	// ContentType is the content type of the part, detected from the file
+	// name extension if empty, application/octet-stream otherwise
+	ContentType string
+
+	Content []byte
+	Reader  io.Reader
+	Path    string
+}
+
+// FileFromBytes returns a file part with in-memory content
+func FileFromBytes(fieldName string, fileName string, content []byte) MultipartFile {
+	return MultipartFile{FieldName: fieldName, FileName: fileName, Content: content}
+}
+
+// FileFromReader returns a file part streamed from a reader
+func FileFromReader(fieldName string, fileName string, reader io.Reader) MultipartFile {
+	return MultipartFile{FieldName: fieldName, FileName: fileName, Reader: reader}
+}
+
+// FileFromPath returns a file part streamed from a file on disk
+func FileFromPath(fieldName string, path string) MultipartFile {
+	return MultipartFile{FieldName: fieldName, Path: path}
+}
+
+// Reader returns the encoded body and its Content-Type header. The body is
+// a *bytes.Buffer if every file has in-memory Content, and otherwise an
+// *io.PipeReader streaming the parts; close it to stop a stream the server
+// does not consume.
+func (m *MultipartBody) Reader() (io.Reader, string, error) {
+	// Work on a copy, so a random boundary is not kept for the next request
+	m = &MultipartBody{Fields: m.Fields, Files: m.Files, Boundary: m.Boundary}
+
+	streamed := false
+	for _, file := range m.Files {
+		if file.streamed() {
+			streamed = true
+		}
+	}
+
+	if !streamed {
+		var buffer bytes.Buffer
+		contentType, err := m.write(&buffer)
+		if err != nil {
+			return nil, "", err
+		}
+		return &buffer, contentType, nil
+	}
+
+	// Missing files are reported before the request is sent
+	for _, file := range m.Files {
+		if file.streamed() && file.Reader == nil {
+			if _, err := os.Stat(file.Path); err != nil {
+				return nil, "", fmt.Errorf("multipart file %q: %w", file.FieldName, err)
+			}
+		}
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	contentType, err := m.contentType()
+	if err != nil {
+		return nil, "", err
+	}
+
+	go func() {
+		_, err := m.write(pipeWriter)
+		pipeWriter.CloseWithError(err)
+	}()
+
+	return pipeReader, contentType, nil
+}
+
+// contentType returns the Content-Type header for the boundary
+func (m *MultipartBody) contentType() (string, error) {
+	writer := multipart.NewWriter(io.Discard)
+	if err := m.setBoundary(writer); err != nil {
+		return "", err
+	}
+	return writer.FormDataContentType(), nil
+}
+
+// setBoundary applies the configured boundary, if any
+func (m *MultipartBody) setBoundary(writer *multipart.Writer) error {
+	if m.Boundary == "" {
+		// Fix the random boundary so the streamed body matches contentType
+		m.Boundary = writer.Boundary()
+		return nil
+	}
+	return writer.SetBoundary(m.Boundary)
+}
+
+// write encodes the body to w and returns its Content-Type header
+func (m *MultipartBody) write(w io.Writer) (string, error) {
+	writer := multipart.NewWriter(w)
+	if err := m.setBoundary(writer); err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(m.Fields))
+	for key := range m.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range m.Fields[key] {
+			if err := writer.WriteField(key, value); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for _, file := range m.Files {
+		if err := writeMultipartFile(writer, file); err != nil {
+			return "", fmt.Errorf("multipart file %q: %w", file.FieldName, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	return writer.FormDataContentType(), nil
+}
+
+// writeMultipartFile writes a file part
+func writeMultipartFile(writer *multipart.Writer, file MultipartFile) error {
+	fileName := file.FileName
+	if fileName == "" && file.Path != "" {
+		fileName = filepath.Base(file.Path)
+	}
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(fileName))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		escapeQuotes(file.FieldName), escapeQuotes(fileName)))
+	header.Set("Content-Type", contentType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !file.streamed():
+		_, err = part.Write(file.Content)
+	case file.Reader != nil:
+		_, err = io.Copy(part, file.Reader)
+	default:
+		var f *os.File
+		f, err = os.Open(file.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(part, f)
+	}
+
+	return err
+}
+
+// streamed reports whether the content is read from Reader or Path
+func (file MultipartFile) streamed() bool {
+	return file.Content == nil && (file.Reader != nil || file.Path != "")
+}
+
+// escapeQuotes escapes a Content-Disposition parameter like mime/multipart
+func escapeQuotes(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
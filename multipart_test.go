@@ -0,0 +1,175 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	urlpkg "net/url"
+)
+
+// multipartEchoHandler parses the multipart form and writes its fields and
+// files, one per line in a stable order
+func multipartEchoHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fmt.Fprintf(w, "title=%s\n", r.FormValue("title"))
+
+	for _, field := range []string{"avatar", "upload", "report"} {
+		for _, header := range r.MultipartForm.File[field] {
+			file, err := header.Open()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			content, _ := io.ReadAll(file)
+			file.Close()
+
+			fmt.Fprintf(w, "%s %s %s %s\n", field, header.Filename, header.Header.Get("Content-Type"), content)
+		}
+	}
+}
+
+func TestNewRequestMultipart(t *testing.T) {
+	req, err := NewRequest(http.MethodPost, "/upload", NewRequestOptions{
+		Multipart: &MultipartBody{
+			Fields:   urlpkg.Values{"title": {"Holiday"}},
+			Files:    []MultipartFile{FileFromBytes("avatar", "me.png", []byte("png-data"))},
+			Boundary: "test-boundary",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	if got := req.Header.Get("Content-Type"); got != "multipart/form-data; boundary=test-boundary" {
+		t.Errorf("Expected multipart Content-Type, got %q", got)
+	}
+
+	// In-memory parts are buffered, so the length is known
+	if req.ContentLength <= 0 {
+		t.Errorf("Expected a known ContentLength, got %d", req.ContentLength)
+	}
+
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatalf("ParseMultipartForm failed: %v", err)
+	}
+	if got := req.FormValue("title"); got != "Holiday" {
+		t.Errorf("Expected title %q, got %q", "Holiday", got)
+	}
+
+	header := req.MultipartForm.File["avatar"][0]
+	if header.Filename != "me.png" {
+		t.Errorf("Expected filename %q, got %q", "me.png", header.Filename)
+	}
+	if got := header.Header.Get("Content-Type"); got != "image/png" {
+		t.Errorf("Expected content type detected from the extension, got %q", got)
+	}
+}
+
+func TestCallEndpointMultipartStreamed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := os.WriteFile(path, []byte(`{"a":1}`), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	body, resp, err := CallEndpoint(http.MethodPost, multipartEchoHandler, NewRequestOptions{
+		Multipart: &MultipartBody{
+			Fields: urlpkg.Values{"title": {"Quarterly"}},
+			Files: []MultipartFile{
+				{FieldName: "upload", FileName: "data.bin", ContentType: "application/x-custom", Reader: strings.NewReader("streamed")},
+				FileFromPath("report", path),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.StatusCode, body)
+	}
+
+	expected := "title=Quarterly\n" +
+		"upload data.bin application/x-custom streamed\n" +
+		"report report.json application/json {\"a\":1}\n"
+	if body != expected {
+		t.Errorf("Expected body %q, got %q", expected, body)
+	}
+}
+
+func TestNewRequestMultipartStreamsReaders(t *testing.T) {
+	req, err := NewRequest(http.MethodPost, "/", NewRequestOptions{
+		Multipart: &MultipartBody{
+			Files: []MultipartFile{FileFromReader("upload", "big.bin", strings.NewReader("data"))},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	defer req.Body.Close()
+
+	if _, ok := req.Body.(*io.PipeReader); !ok {
+		t.Errorf("Expected a streamed body, got %T", req.Body)
+	}
+	if req.ContentLength != 0 {
+		t.Errorf("Expected an unknown ContentLength, got %d", req.ContentLength)
+	}
+}
+
+func TestNewRequestMultipartMissingFile(t *testing.T) {
+	_, err := NewRequest(http.MethodPost, "/", NewRequestOptions{
+		Multipart: &MultipartBody{
+			Files: []MultipartFile{FileFromPath("upload", filepath.Join(t.TempDir(), "missing.txt"))},
+		},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a not exist error, got %v", err)
+	}
+}
+
+func TestNewRequestMultipartEmptyFile(t *testing.T) {
+	body, resp, err := CallEndpoint(http.MethodPost, multipartEchoHandler, NewRequestOptions{
+		Multipart: &MultipartBody{
+			Files: []MultipartFile{FileFromBytes("avatar", "empty.txt", nil)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.StatusCode, body)
+	}
+
+	expected := "title=\navatar empty.txt text/plain; charset=utf-8 \n"
+	if body != expected {
+		t.Errorf("Expected body %q, got %q", expected, body)
+	}
+}
+
+func TestTestHTTPRequestMultipart(t *testing.T) {
+	recorder := NewTestHTTPRequest(http.MethodPost, "/upload").
+		WithMultipartField("title", "Builder").
+		WithMultipartFile(FileFromBytes("avatar", "me.html", []byte("hello"))).
+		Execute(http.HandlerFunc(multipartEchoHandler))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	expected := "title=Builder\navatar me.html text/html; charset=utf-8 hello\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("Expected body %q, got %q", expected, recorder.Body.String())
+	}
+}
@@ -3,26 +3,66 @@ package test
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	urlpkg "net/url"
 )
 
 // NewRequest options for the new request
 type NewRequestOptions struct {
+	// URL is the request URL with path, query and fragment (e.g.
+	// "/users/42?tab=posts#top"), used by CallEndpoint, CallStringEndpoint
+	// and CallMiddleware and by NewRequest when its url is empty.
+	// Defaults to "/".
+	URL string
+
 	// Body use this to set the request body
 	Body string
 
 	// Context allows setting the request context.
+	// The values are applied in a stable order, on top of BaseContext.
 	Context map[any]any
 
+	// ContextValues sets context values in order, after Context
+	ContextValues []ContextValue
+
+	// BaseContext is the parent of the request context, e.g. with values
+	// set by other libraries. Defaults to context.Background().
+	BaseContext context.Context
+
+	// Timeout sets the request context deadline relative to now
+	Timeout time.Duration
+
+	// Deadline sets the request context deadline, the earlier of Deadline
+	// and Timeout applies if both are set. The Call helpers release the
+	// deadline's timer once the handler returned.
+	Deadline time.Time
+
+	// Cancel cancels the request context mid-flight, e.g. to test how a
+	// handler deals with a client disconnecting
+	Cancel *RequestCanceler
+
 	// ContentType allows setting the Content-Type header
 	ContentType string
 
 	// Headers allows setting the request headers
 	Headers map[string]string
 
+	// Cookies are added to the Cookie header
+	Cookies []*http.Cookie
+
+	// BasicAuth sets the Authorization header for HTTP Basic authentication
+	BasicAuth *BasicAuth
+
+	// BearerToken sets the Authorization header to "Bearer <token>", e.g.
+	// with a token minted by a JWTSigner
+	BearerToken string
+
 	// GetValues use this to set the GET values, it will be converted to url.Values
 	// and set as the request query
 	// Deprecated: use QueryValues
@@ -37,18 +77,57 @@ type NewRequestOptions struct {
 	// If set, Body and FormValues will be ignored.
 	JSONData any
 
-	// QueryParams sets the URL query parameters.
+	// BodyData sets the request body encoded with the Encoder registered
+	// for ContentType (e.g. application/xml), see RegisterEncoder.
+	// Takes precedence over FormValues.
+	BodyData any
+
+	// QueryParams sets the URL query parameters, merged into the query of
+	// the URL. Keys set here replace the same keys in the URL.
 	QueryParams urlpkg.Values
 
+	// PathValues sets the route parameters (e.g. {"id": "42"} for
+	// /users/{id}) read with r.PathValue and by the routers registered
+	// with RegisterPathValueAdapter
+	PathValues map[string]string
+
 	// FormValues sets the request body as application/x-www-form-urlencoded.
 	// If set, Body and JSONData will be ignored.
 	FormValues urlpkg.Values
+
+	// Multipart sets the request body as multipart/form-data, with text
+	// fields and files. Takes precedence over JSONData and FormValues.
+	Multipart *MultipartBody
+
+	// RemoteAddr sets the client IP and port (e.g. "203.0.113.7:52100"),
+	// port 1234 is used for a bare IP
+	RemoteAddr string
+
+	// Host sets the Host header the request was sent with
+	Host string
+
+	// Proto sets the protocol version (e.g. "HTTP/2.0"), defaults to HTTP/1.1
+	Proto string
+
+	// TLS simulates an HTTPS request, see NewTLSConnectionState
+	TLS *tls.ConnectionState
+
+	// Proxy adds the Forwarded or X-Forwarded-* headers of a proxy chain
+	// and sets RemoteAddr to the last proxy, unless RemoteAddr is set
+	Proxy *ProxyChain
+
+	// Clock sets the clock handlers read with ClockFromContext(r.Context())
+	Clock *Clock
 }
 
 // NewRequest creates a new Request for testing, but adds RequestURI
 // as the default imlemented in GoLang does not add the RequestURI
 // and leaves it to the end user to implement
 func NewRequest(method string, url string, opts NewRequestOptions) (*http.Request, error) {
+	if url == "" {
+		url = opts.URL
+	}
+
 	if url == "" {
 		url = "/"
 	}
@@ -68,19 +147,31 @@ func NewRequest(method string, url string, opts NewRequestOptions) (*http.Reques
 		opts.FormValues = opts.PostValues
 	}
 
-	// Set Content-Type if not explicitly provided
-	if opts.ContentType != "" {
-		opts.Headers["Content-Type"] = opts.ContentType
-	} else if opts.JSONData != nil {
-		opts.Headers["Content-Type"] = "application/json"
-	} else if opts.FormValues != nil {
-		opts.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+	conn := connection{
+		remoteAddr: opts.RemoteAddr,
+		host:       opts.Host,
+		proto:      opts.Proto,
+		tls:        opts.TLS,
+		proxy:      opts.Proxy,
+	}
+
+	// Checked before a streamed body is started
+	if err := conn.validate(); err != nil {
+		return nil, err
 	}
 
-	var body *bytes.Buffer
+	var body io.Reader
+	multipartContentType := ""
 
 	if opts.Body != "" {
 		body = bytes.NewBuffer([]byte(opts.Body))
+	} else if opts.Multipart != nil {
+		var err error
+		body, multipartContentType, err = opts.Multipart.Reader()
+
+		if err != nil {
+			return nil, err
+		}
 	} else if opts.JSONData != nil {
 		jsonData, err := json.Marshal(opts.JSONData)
 
@@ -89,36 +180,78 @@ func NewRequest(method string, url string, opts NewRequestOptions) (*http.Reques
 		}
 
 		body = bytes.NewBuffer([]byte(jsonData))
+	} else if opts.BodyData != nil {
+		if opts.ContentType == "" {
+			return nil, fmt.Errorf("BodyData needs a ContentType to select its encoder")
+		}
+
+		data, err := EncodeBody(opts.ContentType, opts.BodyData)
+
+		if err != nil {
+			return nil, err
+		}
+
+		body = bytes.NewBuffer(data)
 	} else if opts.FormValues != nil {
 		body = bytes.NewBuffer([]byte(opts.FormValues.Encode()))
 	} else {
 		body = bytes.NewBuffer([]byte{})
 	}
 
+	// Set Content-Type if not explicitly provided
+	if opts.ContentType != "" {
+		opts.Headers["Content-Type"] = opts.ContentType
+	} else if multipartContentType != "" {
+		opts.Headers["Content-Type"] = multipartContentType
+	} else if opts.JSONData != nil {
+		opts.Headers["Content-Type"] = "application/json"
+	} else if opts.FormValues != nil {
+		opts.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+	}
+
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
 		return nil, err
 	}
 
-	u, err := urlpkg.Parse(url)
-	if err != nil {
-		return nil, err
+	// Merge the query parameters into the query of the URL
+	if len(opts.QueryParams) > 0 {
+		query := req.URL.Query()
+		for key, values := range opts.QueryParams {
+			query[key] = values
+		}
+		req.URL.RawQuery = query.Encode()
 	}
 
-	req.RequestURI = u.Path
+	// As sent by a client, without the fragment
+	req.RequestURI = req.URL.RequestURI()
 
-	u.RawQuery = opts.QueryParams.Encode()
-	req.URL.RawQuery = u.RawQuery
+	// Authorization set in Headers takes precedence
+	if opts.BasicAuth != nil {
+		req.SetBasicAuth(opts.BasicAuth.Username, opts.BasicAuth.Password)
+	} else if opts.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.BearerToken)
+	}
 
 	// Set headers
 	for key, value := range opts.Headers {
 		req.Header.Set(key, value)
 	}
 
+	for _, cookie := range opts.Cookies {
+		req.AddCookie(cookie)
+	}
+
 	// Set context values
-	for key, value := range opts.Context {
-		ctx := context.WithValue(req.Context(), key, value)
-		req = req.WithContext(ctx)
+	req = req.WithContext(requestContext(opts))
+
+	conn.apply(req)
+
+	if opts.PathValues != nil {
+		req = applyPathValues(req, opts.PathValues)
 	}
 
 	return req, nil
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// PathValueAdapter injects the path values of a request the way a router
+// stores its route parameters, returning the request to use
+type PathValueAdapter func(r *http.Request, values map[string]string) *http.Request
+
+var (
+	pathValueAdaptersMu sync.RWMutex
+	pathValueAdapters   = map[string]PathValueAdapter{
+		"servemux": serveMuxPathValues,
+	}
+)
+
+// RegisterPathValueAdapter registers an adapter applied by NewRequest to
+// every request with NewRequestOptions.PathValues, replacing any adapter
+// with the same name. A nil adapter removes it. The built in "servemux"
+// adapter sets the values read with r.PathValue.
+//
+// For example, for chi:
+//
+//	RegisterPathValueAdapter("chi", func(r *http.Request, values map[string]string) *http.Request {
+//		rctx := chi.NewRouteContext()
+//		for key, value := range values {
+//			rctx.URLParams.Add(key, value)
+//		}
+//		return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+//	})
+//
+// and for gorilla/mux:
+//
+//	RegisterPathValueAdapter("gorilla", func(r *http.Request, values map[string]string) *http.Request {
+//		return mux.SetURLVars(r, values)
+//	})
+func RegisterPathValueAdapter(name string, adapter PathValueAdapter) {
+	pathValueAdaptersMu.Lock()
+	defer pathValueAdaptersMu.Unlock()
+
+	if adapter == nil {
+		delete(pathValueAdapters, name)
+		return
+	}
+	pathValueAdapters[name] = adapter
+}
+
+// ContextPathValueAdapter returns an adapter storing a copy of the values
+// as a map[string]string in the request context under key, for routers
+// reading their parameters from a context map
+func ContextPathValueAdapter(key any) PathValueAdapter {
+	return func(r *http.Request, values map[string]string) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), key, maps.Clone(values)))
+	}
+}
+
+// applyPathValues applies the registered adapters in name order
+func applyPathValues(r *http.Request, values map[string]string) *http.Request {
+	pathValueAdaptersMu.RLock()
+	names := slices.Sorted(maps.Keys(pathValueAdapters))
+	adapters := make([]PathValueAdapter, 0, len(names))
+	for _, name := range names {
+		adapters = append(adapters, pathValueAdapters[name])
+	}
+	pathValueAdaptersMu.RUnlock()
+
+	for _, adapter := range adapters {
+		r = adapter(r, maps.Clone(values))
+	}
+
+	return r
+}
+
+// serveMuxPathValues sets the values read with r.PathValue
+func serveMuxPathValues(r *http.Request, values map[string]string) *http.Request {
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		r.SetPathValue(key, values[key])
+	}
+	return r
+}
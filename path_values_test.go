@@ -0,0 +1,78 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNewRequestPathValues(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("id") + "/" + r.PathValue("slug")))
+	}
+
+	body, _, err := CallEndpoint(http.MethodGet, handler, NewRequestOptions{
+		PathValues: map[string]string{"id": "42", "slug": "hello"},
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if body != "42/hello" {
+		t.Errorf("Expected body %q, got %q", "42/hello", body)
+	}
+}
+
+func TestRegisterPathValueAdapter(t *testing.T) {
+	type routeParamsKey struct{}
+
+	RegisterPathValueAdapter("test-router", ContextPathValueAdapter(routeParamsKey{}))
+	t.Cleanup(func() { RegisterPathValueAdapter("test-router", nil) })
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		params, _ := r.Context().Value(routeParamsKey{}).(map[string]string)
+		w.Write([]byte(params["id"] + "," + r.PathValue("id")))
+	}
+
+	body, _, err := CallEndpoint(http.MethodGet, handler, NewRequestOptions{
+		PathValues: map[string]string{"id": "7"},
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if body != "7,7" {
+		t.Errorf("Expected both the router and ServeMux values, got %q", body)
+	}
+
+	// Adapters only run for requests with path values
+	body, _, err = CallEndpoint(http.MethodGet, handler, NewRequestOptions{})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if body != "," {
+		t.Errorf("Expected no values, got %q", body)
+	}
+
+	// A nil adapter removes the registration
+	RegisterPathValueAdapter("test-router", nil)
+
+	body, _, err = CallEndpoint(http.MethodGet, handler, NewRequestOptions{
+		PathValues: map[string]string{"id": "7"},
+	})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if body != ",7" {
+		t.Errorf("Expected only the ServeMux value, got %q", body)
+	}
+}
+
+func TestTestHTTPRequestWithPathValue(t *testing.T) {
+	recorder := NewTestHTTPRequest(http.MethodGet, "/users/42").
+		WithPathValue("id", "42").
+		Execute(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.PathValue("id")))
+		}))
+
+	if recorder.Body.String() != "42" {
+		t.Errorf("Expected body %q, got %q", "42", recorder.Body.String())
+	}
+}
@@ -0,0 +1,305 @@
+package test
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// QueryMaps runs a query and returns every row as a map of column name to
+// value. []byte values are returned as strings for readability. Placeholders
+// are rebound for the driver, see Dialect.Rebind.
+func QueryMaps(db *sql.DB, query string, args ...any) ([]map[string]any, error) {
+	columns, rows, err := queryValues(db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		m := make(map[string]any, len(columns))
+		for i, column := range columns {
+			m[column] = row[i]
+		}
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// QueryOne runs a query and scans the first row into a struct of type T.
+// Columns are matched to fields by their `db` tag (or field name, case
+// insensitively); fields of embedded structs are included and sql.Null*
+// types are supported. Columns without a matching field are ignored.
+// Returns sql.ErrNoRows if the query returns no rows.
+func QueryOne[T any](db *sql.DB, query string, args ...any) (T, error) {
+	var result T
+
+	all, err := queryStructs[T](db, query, 1, args...)
+	if err != nil {
+		return result, err
+	}
+
+	if len(all) == 0 {
+		return result, fmt.Errorf("query %q: %w", query, sql.ErrNoRows)
+	}
+
+	return all[0], nil
+}
+
+// QueryAll runs a query and scans every row into a struct of type T,
+// see QueryOne
+func QueryAll[T any](db *sql.DB, query string, args ...any) ([]T, error) {
+	return queryStructs[T](db, query, 0, args...)
+}
+
+// QueryScalar runs a query returning a single column and scans the first
+// row into a value of type T (e.g. QueryScalar[int](db, "SELECT COUNT(*) FROM users")).
+// Returns sql.ErrNoRows if the query returns no rows.
+func QueryScalar[T any](db *sql.DB, query string, args ...any) (T, error) {
+	var result T
+
+	query, args, err := RebindSQL(db, query, args...)
+	if err != nil {
+		return result, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return result, fmt.Errorf("query %q failed: %w", query, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return result, fmt.Errorf("query %q: %w", query, err)
+	}
+
+	if len(columns) != 1 {
+		return result, fmt.Errorf("query %q: expected 1 column, got %d", query, len(columns))
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return result, fmt.Errorf("query %q failed: %w", query, err)
+		}
+		return result, fmt.Errorf("query %q: %w", query, sql.ErrNoRows)
+	}
+
+	if err := rows.Scan(&result); err != nil {
+		return result, fmt.Errorf("query %q: failed to scan column %q: %w", query, columns[0], err)
+	}
+
+	return result, rows.Err()
+}
+
+// FormatQueryTable runs a query and renders the result set as a text table,
+// suitable for t.Log when debugging a test
+func FormatQueryTable(db *sql.DB, query string, args ...any) (string, error) {
+	columns, rows, err := queryValues(db, query, args...)
+	if err != nil {
+		return "", err
+	}
+
+	return formatTable(columns, rows), nil
+}
+
+// queryValues runs a query and returns its columns and raw row values
+func queryValues(db *sql.DB, query string, args ...any) ([]string, [][]any, error) {
+	query, args, err := RebindSQL(db, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query %q failed: %w", query, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, fmt.Errorf("query %q: %w", query, err)
+	}
+
+	result := [][]any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, fmt.Errorf("query %q: failed to scan row: %w", query, err)
+		}
+
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+
+		result = append(result, values)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("query %q failed: %w", query, err)
+	}
+
+	return columns, result, nil
+}
+
+// queryStructs scans up to limit rows (0 for all) into structs of type T
+func queryStructs[T any](db *sql.DB, query string, limit int, args ...any) ([]T, error) {
+	structType := reflect.TypeOf((*T)(nil)).Elem()
+	if structType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query %q: expected a struct type, got %s", query, structType)
+	}
+
+	fieldsByName := map[string]dbField{}
+	for _, field := range structFields(structType) {
+		fieldsByName[strings.ToLower(field.name)] = field
+	}
+
+	query, args, err := RebindSQL(db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query %q failed: %w", query, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("query %q: %w", query, err)
+	}
+
+	result := []T{}
+	for rows.Next() {
+		var item T
+		value := reflect.ValueOf(&item).Elem()
+
+		pointers := make([]any, len(columns))
+		for i, column := range columns {
+			field, ok := fieldsByName[strings.ToLower(column)]
+			if !ok {
+				pointers[i] = new(any)
+				continue
+			}
+			pointers[i] = fieldByIndexAlloc(value, field.index).Addr().Interface()
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("query %q: %w", query, scanColumnError(rows, columns, pointers, err))
+		}
+
+		result = append(result, item)
+
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query %q failed: %w", query, err)
+	}
+
+	return result, nil
+}
+
+// scanColumnError finds the column that failed to scan, as database/sql only
+// reports its index
+func scanColumnError(rows *sql.Rows, columns []string, pointers []any, err error) error {
+	for i, column := range columns {
+		single := make([]any, len(columns))
+		for j := range single {
+			single[j] = new(any)
+		}
+		single[i] = pointers[i]
+
+		if scanErr := rows.Scan(single...); scanErr != nil {
+			return fmt.Errorf("failed to scan column %q: %w", column, scanErr)
+		}
+	}
+	return fmt.Errorf("failed to scan row: %w", err)
+}
+
+// fieldByIndexAlloc returns the field at index, allocating nil embedded
+// struct pointers on the way
+func fieldByIndexAlloc(value reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		value = value.Field(x)
+	}
+	return value
+}
+
+// formatTable renders columns and rows as an aligned text table
+func formatTable(columns []string, rows [][]any) string {
+	cells := make([][]string, len(rows))
+	widths := make([]int, len(columns))
+
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column)
+	}
+
+	for r, row := range rows {
+		cells[r] = make([]string, len(row))
+		for i, value := range row {
+			cells[r][i] = formatCell(value)
+			if width := utf8.RuneCountInString(cells[r][i]); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	var b strings.Builder
+
+	separator := "+"
+	for _, width := range widths {
+		separator += strings.Repeat("-", width+2) + "+"
+	}
+
+	writeRow := func(values []string) {
+		b.WriteString("|")
+		for i, value := range values {
+			b.WriteString(" " + value + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value)) + " |")
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(separator + "\n")
+	writeRow(columns)
+	b.WriteString(separator + "\n")
+	for _, row := range cells {
+		writeRow(row)
+	}
+	b.WriteString(separator + "\n")
+	fmt.Fprintf(&b, "(%d rows)", len(rows))
+
+	return b.String()
+}
+
+func formatCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return strings.ReplaceAll(fmt.Sprint(value), "\n", `\n`)
+}
@@ -0,0 +1,143 @@
+package test
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type queryTestTimestamps struct {
+	CreatedAt string `db:"created_at"`
+}
+
+type queryTestUser struct {
+	queryTestTimestamps
+	ID    int            `db:"id"`
+	Name  string         `db:"name"`
+	Email sql.NullString `db:"email"`
+	Score sql.NullInt64
+}
+
+func newQueryTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:query_test?mode=memory&cache=shared"})
+
+	err := CreateTestTable(db, "query_users", "id INTEGER PRIMARY KEY, name TEXT, email TEXT, score INTEGER, created_at TEXT")
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+	t.Cleanup(func() { DropTestTable(db, "query_users") })
+
+	err = ExecuteSQL(db, `INSERT INTO query_users (name, email, score, created_at) VALUES
+		('Alice', 'alice@example.com', 10, '2024-01-01'),
+		('Bob', NULL, NULL, '2024-01-02')`)
+	if err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	return db
+}
+
+func TestQueryMaps(t *testing.T) {
+	db := newQueryTestDB(t)
+
+	rows, err := QueryMaps(db, "SELECT id, name, email FROM query_users ORDER BY id")
+	if err != nil {
+		t.Fatalf("QueryMaps failed: %v", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0]["name"] != "Alice" || rows[0]["email"] != "alice@example.com" {
+		t.Errorf("Unexpected first row: %v", rows[0])
+	}
+	if rows[1]["email"] != nil {
+		t.Errorf("Expected NULL email to be nil, got %v", rows[1]["email"])
+	}
+}
+
+func TestQueryOneAndAll(t *testing.T) {
+	db := newQueryTestDB(t)
+
+	user, err := QueryOne[queryTestUser](db, "SELECT * FROM query_users WHERE name = ?", "Alice")
+	if err != nil {
+		t.Fatalf("QueryOne failed: %v", err)
+	}
+	if user.ID != 1 || user.Name != "Alice" || user.Email.String != "alice@example.com" || user.Score.Int64 != 10 {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+	if user.CreatedAt != "2024-01-01" {
+		t.Errorf("Expected embedded created_at to be scanned, got %q", user.CreatedAt)
+	}
+
+	users, err := QueryAll[queryTestUser](db, "SELECT id, name, email, score FROM query_users ORDER BY id")
+	if err != nil {
+		t.Fatalf("QueryAll failed: %v", err)
+	}
+	if len(users) != 2 || users[1].Email.Valid || users[1].Score.Valid {
+		t.Errorf("Unexpected users: %+v", users)
+	}
+
+	_, err = QueryOne[queryTestUser](db, "SELECT * FROM query_users WHERE name = ?", "Nobody")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+
+	type badUser struct {
+		Score int `db:"score"`
+	}
+	_, err = QueryAll[badUser](db, "SELECT score FROM query_users ORDER BY id")
+	if err == nil || !strings.Contains(err.Error(), `column "score"`) || !strings.Contains(err.Error(), "SELECT score FROM query_users") {
+		t.Errorf("Expected the error to name the query and column, got %v", err)
+	}
+}
+
+func TestQueryScalar(t *testing.T) {
+	db := newQueryTestDB(t)
+
+	count, err := QueryScalar[int](db, "SELECT COUNT(*) FROM query_users")
+	if err != nil {
+		t.Fatalf("QueryScalar failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+
+	name, err := QueryScalar[string](db, "SELECT name FROM query_users WHERE id = $1", 2)
+	if err != nil {
+		t.Fatalf("QueryScalar failed: %v", err)
+	}
+	if name != "Bob" {
+		t.Errorf("Expected Bob, got %q", name)
+	}
+
+	if _, err := QueryScalar[int](db, "SELECT id, name FROM query_users"); err == nil {
+		t.Errorf("Expected an error for more than one column")
+	}
+}
+
+func TestFormatQueryTable(t *testing.T) {
+	db := newQueryTestDB(t)
+
+	table, err := FormatQueryTable(db, "SELECT id, name, email FROM query_users ORDER BY id")
+	if err != nil {
+		t.Fatalf("FormatQueryTable failed: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"+----+-------+-------------------+",
+		"| id | name  | email             |",
+		"+----+-------+-------------------+",
+		"| 1  | Alice | alice@example.com |",
+		"| 2  | Bob   | NULL              |",
+		"+----+-------+-------------------+",
+		"(2 rows)",
+	}, "\n")
+
+	if table != expected {
+		t.Errorf("Expected table:\n%s\ngot:\n%s", expected, table)
+	}
+}
@@ -0,0 +1,371 @@
+package test
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// maxUniqueAttempts is how often a value is regenerated before giving up
+// on finding one not yet used in a unique column
+const maxUniqueAttempts = 100
+
+// randomWords are used to generate text values
+var randomWords = []string{
+	"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel",
+	"india", "juliet", "kilo", "lima", "mike", "november", "oscar", "papa",
+	"quebec", "romeo", "sierra", "tango", "uniform", "victor", "whiskey",
+	"xray", "yankee", "zulu",
+}
+
+// RandomRowOptions configures GenerateRandomRows and InsertRandomRows
+type RandomRowOptions struct {
+	// Seed makes the data reproducible: the same seed, schema and existing
+	// rows always generate the same rows
+	Seed uint64
+
+	// Values fixes the values of columns (e.g. {"tenant_id": 1})
+	Values map[string]any
+
+	// NullProbability is the chance (0 to 1) of nullable columns being
+	// set to NULL. Defaults to 0, every column gets a value.
+	NullProbability float64
+
+	// Clock is the time dates and timestamps are generated around, within
+	// a year before it. Defaults to 2024-01-01 UTC, so runs are reproducible.
+	Clock *Clock
+}
+
+// rowGenerator generates random rows for a table
+type rowGenerator struct {
+	rand    *rand.Rand
+	opts    *RandomRowOptions
+	now     time.Time
+	table   string
+	columns []schemaColumn
+	parents map[string][]any           // foreign key column to the values it may reference
+	used    map[string]map[string]bool // unique column to the values already used
+}
+
+// GenerateRandomRows introspects a table and generates n random rows that
+// satisfy its constraints: values match the column types and lengths, NOT
+// NULL columns are always set, unique columns get values not yet in the
+// table and foreign keys reference existing parent rows. Auto increment
+// columns and columns with a default are left to the database unless
+// set in Values.
+func GenerateRandomRows(db *sql.DB, table string, n int, opts *RandomRowOptions) ([]map[string]any, error) {
+	generator, err := newRowGenerator(db, table, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]any, 0, n)
+	for range n {
+		row, err := generator.row()
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// InsertRandomRows generates n random rows with GenerateRandomRows and
+// inserts them into the table in a single transaction
+func InsertRandomRows(db *sql.DB, table string, n int, opts *RandomRowOptions) ([]map[string]any, error) {
+	generator, err := newRowGenerator(db, table, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dialect := DialectForDB(db)
+
+	columns := []string{}
+	placeholders := []string{}
+	for i, column := range generator.columns {
+		columns = append(columns, column.name)
+		placeholders = append(placeholders, dialect.Placeholder(i+1))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", dialect.QuoteIdentifier(table),
+		quoteIdentifiers(dialect.Name(), columns), strings.Join(placeholders, ", "))
+	if len(columns) == 0 {
+		query = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", dialect.QuoteIdentifier(table))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows := make([]map[string]any, 0, n)
+	for range n {
+		row, err := generator.row()
+		if err != nil {
+			return nil, err
+		}
+
+		args := make([]any, len(columns))
+		for i, column := range columns {
+			args[i] = row[column]
+		}
+
+		if _, err := tx.Exec(query, args...); err != nil {
+			return nil, fmt.Errorf("failed to insert random row into %s: %w", table, err)
+		}
+
+		rows = append(rows, row)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit random rows: %w", err)
+	}
+
+	return rows, nil
+}
+
+// newRowGenerator introspects the table and loads the parent rows and the
+// values of unique columns already in use
+func newRowGenerator(db *sql.DB, table string, opts *RandomRowOptions) (*rowGenerator, error) {
+	if opts == nil {
+		opts = &RandomRowOptions{}
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if opts.Clock != nil {
+		now = opts.Clock.Now()
+	}
+
+	generator := &rowGenerator{
+		rand:    rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15)),
+		opts:    opts,
+		now:     now,
+		table:   table,
+		parents: map[string][]any{},
+		used:    map[string]map[string]bool{},
+	}
+
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, column := range columns {
+		if _, fixed := opts.Values[column.name]; fixed || !(column.autoIncrement || column.hasDefault) {
+			generator.columns = append(generator.columns, column)
+		}
+	}
+
+	for name := range opts.Values {
+		if !generator.hasColumn(name) {
+			return nil, fmt.Errorf("table %s has no column %q", table, name)
+		}
+	}
+
+	keys, err := foreignKeys(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	dialect := DialectForDB(db)
+	for _, key := range keys {
+		if !generator.hasColumn(key.column) {
+			continue
+		}
+
+		refColumn := dialect.QuoteIdentifier(key.refColumn)
+		_, rows, err := queryValues(db, fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IS NOT NULL ORDER BY %s",
+			refColumn, dialect.QuoteIdentifier(key.refTable), refColumn, refColumn))
+		if err != nil {
+			return nil, err
+		}
+
+		values := []any{}
+		for _, row := range rows {
+			values = append(values, row[0])
+		}
+		generator.parents[key.column] = values
+	}
+
+	for _, column := range generator.columns {
+		if !column.unique && !column.primaryKey {
+			continue
+		}
+
+		_, rows, err := queryValues(db, fmt.Sprintf("SELECT %s FROM %s", dialect.QuoteIdentifier(column.name), dialect.QuoteIdentifier(table)))
+		if err != nil {
+			return nil, err
+		}
+
+		used := map[string]bool{}
+		for _, row := range rows {
+			used[fmt.Sprint(row[0])] = true
+		}
+		generator.used[column.name] = used
+	}
+
+	return generator, nil
+}
+
+// hasColumn reports whether the generator sets the column
+func (g *rowGenerator) hasColumn(name string) bool {
+	for _, column := range g.columns {
+		if column.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// row generates the next row
+func (g *rowGenerator) row() (map[string]any, error) {
+	row := map[string]any{}
+
+	for _, column := range g.columns {
+		if value, fixed := g.opts.Values[column.name]; fixed {
+			row[column.name] = value
+			continue
+		}
+
+		if !column.notNull && !column.primaryKey && g.rand.Float64() < g.opts.NullProbability {
+			row[column.name] = nil
+			continue
+		}
+
+		used, unique := g.used[column.name]
+
+		var value any
+		for attempt := 0; ; attempt++ {
+			if attempt == maxUniqueAttempts {
+				return nil, fmt.Errorf("failed to generate a unique value for %s.%s after %d attempts", g.table, column.name, attempt)
+			}
+
+			var err error
+			value, err = g.value(column)
+			if err != nil {
+				return nil, err
+			}
+
+			if !unique || value == nil || !used[fmt.Sprint(value)] {
+				break
+			}
+		}
+
+		if unique && value != nil {
+			used[fmt.Sprint(value)] = true
+		}
+		row[column.name] = value
+	}
+
+	return row, nil
+}
+
+// value generates a random value for a column
+func (g *rowGenerator) value(column schemaColumn) (any, error) {
+	if parents, ok := g.parents[column.name]; ok {
+		if len(parents) == 0 {
+			if column.notNull {
+				return nil, fmt.Errorf("column %s.%s references a table without rows, insert parent rows first", g.table, column.name)
+			}
+			return nil, nil
+		}
+		return parents[g.rand.IntN(len(parents))], nil
+	}
+
+	t := column.dataType
+	name := strings.ToLower(column.name)
+
+	switch {
+	case t == "bool" || t == "boolean" || (t == "tinyint" && column.length == 1):
+		return g.rand.IntN(2) == 1, nil
+	case t == "tinyint":
+		return int64(g.rand.IntN(127) + 1), nil
+	case t == "smallint" || t == "int2":
+		return int64(g.rand.IntN(32767) + 1), nil
+	case strings.Contains(t, "int") || strings.Contains(t, "serial"):
+		if column.unique || column.primaryKey {
+			return int64(g.rand.IntN(math.MaxInt32) + 1), nil
+		}
+		return int64(g.rand.IntN(1000000) + 1), nil
+	case strings.Contains(t, "decimal") || strings.Contains(t, "numeric") || strings.Contains(t, "real") ||
+		strings.Contains(t, "float") || strings.Contains(t, "double") || t == "money":
+		return math.Round(g.rand.Float64()*1000000) / 100, nil
+	case strings.Contains(t, "timestamp") || strings.Contains(t, "datetime"):
+		return g.time().Format(time.DateTime), nil
+	case t == "date":
+		return g.time().Format(time.DateOnly), nil
+	case t == "time" || strings.HasPrefix(t, "time "):
+		return g.time().Format(time.TimeOnly), nil
+	case t == "json" || t == "jsonb":
+		return fmt.Sprintf(`{"%s": %d}`, g.word(), g.rand.IntN(1000)), nil
+	case strings.Contains(t, "blob") || strings.Contains(t, "binary") || t == "bytea":
+		b := make([]byte, 16)
+		for i := range b {
+			b[i] = byte(g.rand.IntN(256))
+		}
+		return b, nil
+	case t == "uuid":
+		return g.uuid(), nil
+	case strings.Contains(name, "email"):
+		return g.truncate(fmt.Sprintf("%s.%s%d@example.com", g.word(), g.word(), g.rand.IntN(10000)), column.length), nil
+	case strings.Contains(name, "url"):
+		return g.truncate(fmt.Sprintf("https://example.com/%s/%d", g.word(), g.rand.IntN(10000)), column.length), nil
+	}
+
+	return g.text(column.length), nil
+}
+
+// time returns a random time within the year before now, in whole seconds
+func (g *rowGenerator) time() time.Time {
+	return g.now.Add(-time.Duration(g.rand.Int64N(365*24*3600)) * time.Second).UTC()
+}
+
+// word returns a random word
+func (g *rowGenerator) word() string {
+	return randomWords[g.rand.IntN(len(randomWords))]
+}
+
+// text returns random words, at most length characters long (32 if 0)
+func (g *rowGenerator) text(length int) string {
+	if length <= 0 {
+		length = 32
+	}
+
+	words := []string{g.word(), g.word(), fmt.Sprint(g.rand.IntN(1000))}
+	return g.truncate(strings.Join(words, " "), length)
+}
+
+// truncate shortens a value to the column length, regenerating it from
+// random letters if there is little room for words
+func (g *rowGenerator) truncate(value string, length int) string {
+	if length <= 0 || len(value) <= length {
+		return value
+	}
+
+	if length < 8 {
+		letters := make([]byte, length)
+		for i := range letters {
+			letters[i] = byte('a' + g.rand.IntN(26))
+		}
+		return string(letters)
+	}
+
+	return strings.TrimSpace(value[:length])
+}
+
+// uuid returns a random version 4 UUID drawn from the seeded generator
+func (g *rowGenerator) uuid() string {
+	b := make([]byte, 16)
+	for i := range b {
+		b[i] = byte(g.rand.IntN(256))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInsertRandomRows(t *testing.T) {
+	db := NewTestDBT(t, &DBConfig{Driver: "sqlite", Database: "file:random_rows?mode=memory&cache=shared", Pragmas: map[string]string{"foreign_keys": "ON"}})
+
+	for _, statement := range []string{
+		"CREATE TABLE teams (id INTEGER PRIMARY KEY, name VARCHAR(20) NOT NULL UNIQUE)",
+		`CREATE TABLE users (
+			id INTEGER PRIMARY KEY,
+			team_id INTEGER NOT NULL REFERENCES teams(id),
+			email VARCHAR(40) NOT NULL UNIQUE,
+			code CHAR(4) NOT NULL,
+			score DECIMAL(10, 2),
+			active BOOLEAN NOT NULL,
+			born DATE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	} {
+		if err := ExecuteSQL(db, statement); err != nil {
+			t.Fatalf("Failed to create table: %v", err)
+		}
+	}
+
+	if _, err := InsertRandomRows(db, "users", 1, nil); err == nil {
+		t.Errorf("Expected an error when the referenced table has no rows")
+	}
+
+	if _, err := InsertRandomRows(db, "teams", 5, &RandomRowOptions{Seed: 1}); err != nil {
+		t.Fatalf("InsertRandomRows failed for teams: %v", err)
+	}
+
+	preview, err := GenerateRandomRows(db, "users", 50, &RandomRowOptions{Seed: 42})
+	if err != nil {
+		t.Fatalf("GenerateRandomRows failed: %v", err)
+	}
+
+	rows, err := InsertRandomRows(db, "users", 50, &RandomRowOptions{Seed: 42, Values: map[string]any{"active": true}})
+	if err != nil {
+		t.Fatalf("InsertRandomRows failed for users: %v", err)
+	}
+
+	if len(rows) != 50 || rows[0]["active"] != true {
+		t.Errorf("Expected 50 rows with the fixed value, got %d: %v", len(rows), rows[0])
+	}
+
+	if preview[0]["email"] != rows[0]["email"] || preview[0]["team_id"] != rows[0]["team_id"] {
+		t.Errorf("Expected the same seed to generate the same rows, got %v and %v", preview[0], rows[0])
+	}
+
+	for _, row := range rows {
+		if len(row["code"].(string)) > 4 || len(row["email"].(string)) > 40 {
+			t.Errorf("Expected values to fit the column lengths, got %v", row)
+		}
+		if _, ok := row["created_at"]; ok {
+			t.Errorf("Expected columns with defaults to be left to the database, got %v", row)
+		}
+	}
+
+	orphans, err := QueryScalar[int](db, "SELECT COUNT(*) FROM users WHERE team_id NOT IN (SELECT id FROM teams)")
+	if err != nil || orphans != 0 {
+		t.Errorf("Expected every user to reference a team, got %d orphans (%v)", orphans, err)
+	}
+
+	// Existing unique values are avoided, so a second batch inserts cleanly
+	if _, err := InsertRandomRows(db, "users", 50, &RandomRowOptions{Seed: 42}); err != nil {
+		t.Errorf("Expected a second batch with the same seed to avoid existing unique values: %v", err)
+	}
+
+	again, err := GenerateRandomRows(db, "teams", 3, &RandomRowOptions{Seed: 7})
+	if err != nil {
+		t.Fatalf("GenerateRandomRows failed: %v", err)
+	}
+	repeated, _ := GenerateRandomRows(db, "teams", 3, &RandomRowOptions{Seed: 7})
+	if !reflect.DeepEqual(again, repeated) {
+		t.Errorf("Expected reproducible rows, got %v and %v", again, repeated)
+	}
+
+	if _, err := InsertRandomRows(db, "users", 1, &RandomRowOptions{Values: map[string]any{"missing": 1}}); err == nil {
+		t.Errorf("Expected an error for a value of an unknown column")
+	}
+}
+
+func TestParseColumnType(t *testing.T) {
+	tests := map[string]struct {
+		name   string
+		length int
+	}{
+		"VARCHAR(255)":   {"varchar", 255},
+		"decimal(10, 2)": {"decimal", 10},
+		"TEXT":           {"text", 0},
+		"":               {"", 0},
+	}
+
+	for declared, expected := range tests {
+		name, length := parseColumnType(declared)
+		if name != expected.name || length != expected.length {
+			t.Errorf("%q: expected %s(%d), got %s(%d)", declared, expected.name, expected.length, name, length)
+		}
+	}
+}
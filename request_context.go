@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ContextValue is a value set in the request context
+type ContextValue struct {
+	Key   any
+	Value any
+}
+
+// RequestCanceler cancels the context of the requests built with it, to
+// simulate a client disconnecting mid-flight
+type RequestCanceler struct {
+	mu      sync.Mutex
+	cancels []context.CancelCauseFunc
+	cause   error
+}
+
+// NewRequestCanceler returns a canceler for NewRequestOptions.Cancel
+func NewRequestCanceler() *RequestCanceler {
+	return &RequestCanceler{}
+}
+
+// Cancel cancels the requests with context.Canceled, as net/http does
+// when the client disconnects. Requests built afterwards start cancelled.
+func (c *RequestCanceler) Cancel() {
+	c.CancelWithCause(context.Canceled)
+}
+
+// CancelWithCause cancels the requests, context.Cause returns cause
+func (c *RequestCanceler) CancelWithCause(cause error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cause != nil {
+		return
+	}
+
+	// Innermost contexts first, so they keep the cause
+	c.cause = cause
+	for i := len(c.cancels) - 1; i >= 0; i-- {
+		c.cancels[i](cause)
+	}
+	c.cancels = nil
+}
+
+// CancelAfter cancels the requests after d, e.g. while the handler runs.
+// The returned function stops the timer.
+func (c *RequestCanceler) CancelAfter(d time.Duration) (stop func() bool) {
+	return time.AfterFunc(d, c.Cancel).Stop
+}
+
+// Cancelled reports whether the requests have been cancelled
+func (c *RequestCanceler) Cancelled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cause != nil
+}
+
+// add registers the cancel function of a request, cancelling it at once if
+// the canceler already fired
+func (c *RequestCanceler) add(cancel context.CancelCauseFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cause != nil {
+		cancel(c.cause)
+		return
+	}
+	c.cancels = append(c.cancels, cancel)
+}
+
+// requestContext builds the request context: BaseContext, the Context
+// values in a stable order, ContextValues in order, the clock, the
+// deadline and the canceler
+func requestContext(opts NewRequestOptions) context.Context {
+	ctx := opts.BaseContext
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Sort the keys, so the values are applied in the same order every run
+	keys := make([]any, 0, len(opts.Context))
+	for key := range opts.Context {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprintf("%T %v", keys[i], keys[i]) < fmt.Sprintf("%T %v", keys[j], keys[j])
+	})
+
+	for _, key := range keys {
+		ctx = context.WithValue(ctx, key, opts.Context[key])
+	}
+
+	for _, value := range opts.ContextValues {
+		ctx = context.WithValue(ctx, value.Key, value.Value)
+	}
+
+	if opts.Clock != nil {
+		ctx = ContextWithClock(ctx, opts.Clock)
+	}
+
+	deadline := opts.Deadline
+	if opts.Timeout > 0 {
+		if timeout := time.Now().Add(opts.Timeout); deadline.IsZero() || timeout.Before(deadline) {
+			deadline = timeout
+		}
+	}
+
+	if !deadline.IsZero() {
+		var stop context.CancelFunc
+		ctx, stop = context.WithDeadline(ctx, deadline)
+
+		// Released by the Call helpers once the handler returned, see
+		// releaseRequest, or by the canceler
+		ctx = context.WithValue(ctx, releaseRequestKey{}, stop)
+		if opts.Cancel != nil {
+			opts.Cancel.add(func(error) { stop() })
+		}
+	}
+
+	if opts.Cancel != nil {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		opts.Cancel.add(cancel)
+	}
+
+	return ctx
+}
+
+// releaseRequestKey is the context key of the function releasing the
+// deadline timer of a request
+type releaseRequestKey struct{}
+
+// releaseRequest releases the deadline timer of a request built by
+// NewRequest, called after serving it
+func releaseRequest(req *http.Request) {
+	if stop, ok := req.Context().Value(releaseRequestKey{}).(context.CancelFunc); ok {
+		stop()
+	}
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type requestContextKey string
+
+func TestNewRequestBaseContext(t *testing.T) {
+	base, cancel := context.WithCancel(context.WithValue(context.Background(), requestContextKey("tenant"), "acme"))
+
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{
+		BaseContext: base,
+		Context:     map[any]any{requestContextKey("user"): "ada"},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	ctx := req.Context()
+	if ctx.Value(requestContextKey("tenant")) != "acme" || ctx.Value(requestContextKey("user")) != "ada" {
+		t.Errorf("Expected the base and option values, got %v and %v", ctx.Value(requestContextKey("tenant")), ctx.Value(requestContextKey("user")))
+	}
+
+	// Cancelling the base cancels the request
+	cancel()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Expected the request context to be cancelled, got %v", ctx.Err())
+	}
+}
+
+func TestNewRequestContextValuesOrder(t *testing.T) {
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{
+		Context: map[any]any{requestContextKey("role"): "user"},
+		ContextValues: []ContextValue{
+			{Key: requestContextKey("role"), Value: "editor"},
+			{Key: requestContextKey("role"), Value: "admin"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	if got := req.Context().Value(requestContextKey("role")); got != "admin" {
+		t.Errorf("Expected the last value to win, got %v", got)
+	}
+}
+
+func TestNewRequestTimeout(t *testing.T) {
+	body, _, err := CallEndpoint(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			http.Error(w, r.Context().Err().Error(), http.StatusServiceUnavailable)
+		case <-time.After(5 * time.Second):
+			w.Write([]byte("too slow"))
+		}
+	}, NewRequestOptions{Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	if body != "context deadline exceeded\n" {
+		t.Errorf("Expected the deadline to be exceeded, got %q", body)
+	}
+}
+
+func TestCallEndpointReleasesDeadline(t *testing.T) {
+	var ctx context.Context
+	_, _, err := CallEndpoint(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}, NewRequestOptions{Timeout: time.Hour})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	// The timer is stopped once the handler returned, not after an hour
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Expected the deadline to be released, got %v", ctx.Err())
+	}
+}
+
+func TestNewRequestDeadline(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{
+		Deadline: deadline,
+		Timeout:  2 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	// The earlier of Deadline and Timeout applies
+	got, ok := req.Context().Deadline()
+	if !ok || !got.Equal(deadline) {
+		t.Errorf("Expected deadline %v, got %v (%t)", deadline, got, ok)
+	}
+}
+
+func TestNewRequestCancel(t *testing.T) {
+	canceler := NewRequestCanceler()
+	started := make(chan struct{})
+
+	go func() {
+		<-started
+		canceler.Cancel()
+	}()
+
+	body, _, err := CallEndpoint(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-r.Context().Done():
+			w.Write([]byte("client gone: " + r.Context().Err().Error()))
+		case <-time.After(5 * time.Second):
+			w.Write([]byte("not cancelled"))
+		}
+	}, NewRequestOptions{Cancel: canceler, Timeout: time.Minute})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	if body != "client gone: context canceled" {
+		t.Errorf("Expected the request to be cancelled mid-flight, got %q", body)
+	}
+	if !canceler.Cancelled() {
+		t.Error("Expected the canceler to report the cancellation")
+	}
+
+	// Requests built after the cancellation start cancelled
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{Cancel: canceler})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if req.Context().Err() == nil {
+		t.Error("Expected the request to start cancelled")
+	}
+}
+
+func TestRequestCancelerCause(t *testing.T) {
+	cause := errors.New("connection reset")
+	canceler := NewRequestCanceler()
+
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{Cancel: canceler, Timeout: time.Minute})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	stop := canceler.CancelAfter(time.Millisecond)
+	defer stop()
+
+	<-req.Context().Done()
+
+	if got := context.Cause(req.Context()); !errors.Is(got, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", got)
+	}
+
+	other := NewRequestCanceler()
+	req, err = NewRequest(http.MethodGet, "/", NewRequestOptions{Cancel: other, Timeout: time.Minute})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	other.CancelWithCause(cause)
+	if got := context.Cause(req.Context()); got != cause {
+		t.Errorf("Expected the cause %v, got %v", cause, got)
+	}
+}
@@ -0,0 +1,221 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httputil"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// CurlCommand renders the request as a copy-pasteable curl command sent to
+// baseURL (e.g. "http://localhost:8080"), or to the host of the request if
+// baseURL is empty. Multipart bodies are rendered as -F parts, with files
+// read from their file name. The body is left readable.
+func CurlCommand(req *http.Request, baseURL string) (string, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+
+	// curl sends bodies with POST unless told otherwise
+	url := strings.TrimSuffix(requestBaseURL(req, baseURL), "/") + req.URL.RequestURI()
+	if (req.Method == http.MethodGet || req.Method == "") && len(body) == 0 {
+		lines = append(lines, "curl "+shellQuote(url))
+	} else {
+		lines = append(lines, "curl -X "+req.Method+" "+shellQuote(url))
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	isMultipart := mediaType == "multipart/form-data" && params["boundary"] != "" && body != nil
+
+	for _, key := range slices.Sorted(maps.Keys(req.Header)) {
+		// curl sets the content type with its own boundary
+		if isMultipart && key == "Content-Type" {
+			continue
+		}
+		for _, value := range req.Header[key] {
+			lines = append(lines, "-H "+shellQuote(key+": "+value))
+		}
+	}
+
+	switch {
+	case isMultipart:
+		parts, err := curlMultipartParts(body, params["boundary"])
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, parts...)
+	case len(body) > 0 && utf8.Valid(body):
+		lines = append(lines, "--data-raw "+shellQuote(string(body)))
+	case len(body) > 0:
+		lines = append(lines, fmt.Sprintf("--data-binary @body.bin # %d byte binary body, not shown", len(body)))
+	}
+
+	return strings.Join(lines, " \\\n  "), nil
+}
+
+// DumpRequest renders the request as it would be sent over HTTP/1.1. The
+// body is left readable.
+func DumpRequest(req *http.Request) (string, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return "", err
+	}
+
+	clone := req.Clone(req.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	if body == nil {
+		clone.Body = nil
+	}
+
+	dump, err := httputil.DumpRequest(clone, true)
+	if err != nil {
+		return "", err
+	}
+
+	return string(dump), nil
+}
+
+// LogRequestOnFailure logs the request as a curl command and a raw HTTP
+// dump when the test fails. CallEndpointT, CallStringEndpointT and the
+// ExecuteT methods call it for their requests.
+func LogRequestOnFailure(t testing.TB, req *http.Request) {
+	t.Helper()
+
+	snapshotBody(req)
+
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+
+		// Streamed bodies were consumed by the handler
+		logged := req
+		note := ""
+		if req.GetBody == nil && req.Body != nil && req.Body != http.NoBody {
+			logged = req.Clone(req.Context())
+			logged.Body = nil
+			note = " (streamed body not shown)"
+		}
+
+		curl, err := CurlCommand(logged, "")
+		if err != nil {
+			curl = "curl: " + err.Error()
+		}
+
+		dump, err := DumpRequest(logged)
+		if err != nil {
+			dump = "dump: " + err.Error()
+		}
+
+		t.Logf("request %s %s%s\n%s\n\n%s", req.Method, req.URL.RequestURI(), note, curl, dump)
+	})
+}
+
+// snapshotBody makes the body readable again after the handler read it by
+// setting GetBody. Streamed bodies are left alone.
+func snapshotBody(req *http.Request) {
+	if req.GetBody != nil || req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	if _, streamed := req.Body.(*io.PipeReader); streamed {
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		req.Body = io.NopCloser(bytes.NewReader(nil))
+		return
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// requestBody returns the body of the request, nil if it has none, and
+// leaves it readable. Bodies read by a handler are only available through
+// GetBody; streamed bodies are read to the end.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+// requestBaseURL returns the scheme and host the request is sent to
+func requestBaseURL(req *http.Request, baseURL string) string {
+	switch {
+	case baseURL != "":
+		return baseURL
+	case req.URL.IsAbs():
+		return req.URL.Scheme + "://" + req.URL.Host
+	case req.Host != "":
+		return "http://" + req.Host
+	}
+	return "http://localhost"
+}
+
+// curlMultipartParts renders the parts of a multipart body as -F options
+func curlMultipartParts(body []byte, boundary string) ([]string, error) {
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+
+	parts := []string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart body: %w", err)
+		}
+
+		if part.FileName() != "" {
+			value := part.FormName() + "=@" + part.FileName()
+			if contentType := part.Header.Get("Content-Type"); contentType != "" {
+				value += ";type=" + contentType
+			}
+			parts = append(parts, "-F "+shellQuote(value))
+			continue
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart body: %w", err)
+		}
+		parts = append(parts, "-F "+shellQuote(part.FormName()+"="+string(value)))
+	}
+}
+
+// shellQuote quotes a value for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,165 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	urlpkg "net/url"
+)
+
+// dumpTB runs cleanups on demand and records the logs
+type dumpTB struct {
+	testing.TB
+	failed   bool
+	logs     []string
+	cleanups []func()
+}
+
+func (tb *dumpTB) Helper()                 {}
+func (tb *dumpTB) Failed() bool            { return tb.failed }
+func (tb *dumpTB) Cleanup(f func())        { tb.cleanups = append(tb.cleanups, f) }
+func (tb *dumpTB) Logf(f string, a ...any) { tb.logs = append(tb.logs, fmt.Sprintf(f, a...)) }
+
+func (tb *dumpTB) finish() {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+}
+
+func TestCurlCommand(t *testing.T) {
+	req, err := NewRequest(http.MethodPost, "/users?active=1", NewRequestOptions{
+		JSONData: map[string]string{"name": "O'Brien"},
+		Cookies:  []*http.Cookie{{Name: "session", Value: "abc"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	curl, err := CurlCommand(req, "http://localhost:8080")
+	if err != nil {
+		t.Fatalf("CurlCommand failed: %v", err)
+	}
+
+	expected := `curl -X POST 'http://localhost:8080/users?active=1' \
+  -H 'Content-Type: application/json' \
+  -H 'Cookie: session=abc' \
+  --data-raw '{"name":"O'\''Brien"}'`
+	if curl != expected {
+		t.Errorf("Expected curl command:\n%s\ngot:\n%s", expected, curl)
+	}
+
+	// The body is still readable
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != `{"name":"O'Brien"}` {
+		t.Errorf("Expected the body to be left readable, got %q", body)
+	}
+}
+
+func TestCurlCommandMultipart(t *testing.T) {
+	req, err := NewRequest(http.MethodPost, "http://example.com/upload", NewRequestOptions{
+		Multipart: &MultipartBody{
+			Fields: urlpkg.Values{"title": {"Holiday"}},
+			Files:  []MultipartFile{FileFromBytes("avatar", "me.png", []byte("png"))},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	curl, err := CurlCommand(req, "")
+	if err != nil {
+		t.Fatalf("CurlCommand failed: %v", err)
+	}
+
+	expected := `curl -X POST 'http://example.com/upload' \
+  -F 'title=Holiday' \
+  -F 'avatar=@me.png;type=image/png'`
+	if curl != expected {
+		t.Errorf("Expected curl command:\n%s\ngot:\n%s", expected, curl)
+	}
+}
+
+func TestDumpRequest(t *testing.T) {
+	req := NewTestHTTPRequest(http.MethodPut, "/items/1").
+		WithJSONBody(`{"a":1}`).
+		WithBearerToken("token").
+		build()
+
+	snapshotBody(req)
+
+	dump, err := DumpRequest(req)
+	if err != nil {
+		t.Fatalf("DumpRequest failed: %v", err)
+	}
+
+	expected := "PUT /items/1 HTTP/1.1\r\nHost: example.com\r\nAuthorization: Bearer token\r\nContent-Type: application/json\r\n\r\n{\"a\":1}"
+	if dump != expected {
+		t.Errorf("Expected dump %q, got %q", expected, dump)
+	}
+}
+
+func TestLogRequestOnFailure(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+	}
+
+	passing := &dumpTB{TB: t}
+	CallEndpointT(passing, http.MethodPost, handler, NewRequestOptions{Body: "payload"})
+	passing.finish()
+
+	if len(passing.logs) != 0 {
+		t.Errorf("Expected no logs for a passing test, got %v", passing.logs)
+	}
+
+	failing := &dumpTB{TB: t, failed: true}
+	CallEndpointT(failing, http.MethodPost, handler, NewRequestOptions{Body: "payload"})
+	failing.finish()
+
+	// The body read by the handler is logged
+	if len(failing.logs) != 1 || !strings.Contains(failing.logs[0], "--data-raw 'payload'") ||
+		!strings.Contains(failing.logs[0], "POST / HTTP/1.1") || !strings.HasSuffix(failing.logs[0], "payload") {
+		t.Errorf("Expected the curl command and dump to be logged, got %v", failing.logs)
+	}
+
+	executed := &dumpTB{TB: t, failed: true}
+	NewTestHTTPRequest(http.MethodGet, "/search?q=go").ExecuteT(executed, http.HandlerFunc(handler))
+	executed.finish()
+
+	if len(executed.logs) != 1 || !strings.Contains(executed.logs[0], "curl 'http://example.com/search?q=go'") {
+		t.Errorf("Expected the executed request to be logged, got %v", executed.logs)
+	}
+
+	session := &dumpTB{TB: t, failed: true}
+	NewTestSession().ExecuteT(session, NewTestHTTPRequest(http.MethodGet, "/account"), http.HandlerFunc(handler))
+	session.finish()
+
+	if len(session.logs) != 1 || !strings.Contains(session.logs[0], "curl 'http://example.com/account'") {
+		t.Errorf("Expected the session request to be logged, got %v", session.logs)
+	}
+
+	stringEndpoint := &dumpTB{TB: t, failed: true}
+	CallStringEndpointT(stringEndpoint, http.MethodDelete, func(w http.ResponseWriter, r *http.Request) string { return "" }, NewRequestOptions{URL: "/items/1"})
+	stringEndpoint.finish()
+
+	if len(stringEndpoint.logs) != 1 || !strings.Contains(stringEndpoint.logs[0], "DELETE /items/1 HTTP/1.1") {
+		t.Errorf("Expected the string endpoint request to be logged, got %v", stringEndpoint.logs)
+	}
+}
+
+func TestLogRequestOnFailureStreamed(t *testing.T) {
+	failing := &dumpTB{TB: t, failed: true}
+
+	CallEndpointT(failing, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {}, NewRequestOptions{
+		Multipart: &MultipartBody{
+			Files: []MultipartFile{FileFromReader("upload", "big.bin", strings.NewReader("data"))},
+		},
+	})
+	failing.finish()
+
+	if len(failing.logs) != 1 || !strings.Contains(failing.logs[0], "streamed body not shown") {
+		t.Errorf("Expected the streamed body to be left out, got %v", failing.logs)
+	}
+}
@@ -0,0 +1,317 @@
+package test
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// currentSchemaSQL returns the SQL expression for the schema (MySQL:
+// database) unqualified table names resolve to
+func currentSchemaSQL(dialect string) string {
+	if dialect == DialectMySQL {
+		return "DATABASE()"
+	}
+	return "current_schema()"
+}
+
+// tableNames returns the names of the user tables in the database, sorted
+func tableNames(db *sql.DB) ([]string, error) {
+	dialect := DialectForDB(db).Name()
+
+	var query string
+	switch dialect {
+	case DialectSQLite:
+		query = "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"
+	case DialectMySQL, DialectPostgres:
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = " + currentSchemaSQL(dialect) +
+			" AND table_type = 'BASE TABLE' ORDER BY table_name"
+	default:
+		return nil, fmt.Errorf("listing tables is not supported for driver %q", driverForDB(db))
+	}
+
+	return queryColumn[string](db, query)
+}
+
+// tableColumnNames returns the column names of a table in declaration order
+func tableColumnNames(db *sql.DB, table string) ([]string, error) {
+	dialect := DialectForDB(db).Name()
+
+	switch dialect {
+	case DialectSQLite:
+		return queryColumn[string](db, "SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
+	case DialectMySQL, DialectPostgres:
+		return queryColumn[string](db, "SELECT column_name FROM information_schema.columns WHERE table_schema = "+
+			currentSchemaSQL(dialect)+" AND table_name = ? ORDER BY ordinal_position", table)
+	}
+
+	return nil, fmt.Errorf("listing columns is not supported for driver %q", driverForDB(db))
+}
+
+// primaryKeyColumns returns the primary key columns of a table in key
+// order, or none if the table has no primary key
+func primaryKeyColumns(db *sql.DB, table string) ([]string, error) {
+	dialect := DialectForDB(db).Name()
+
+	switch dialect {
+	case DialectSQLite:
+		return queryColumn[string](db, "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", table)
+	case DialectMySQL, DialectPostgres:
+		return queryColumn[string](db, "SELECT kcu.column_name FROM information_schema.table_constraints tc"+
+			" JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = tc.constraint_name"+
+			" AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name"+
+			" WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = "+currentSchemaSQL(dialect)+
+			" AND tc.table_name = ? ORDER BY kcu.ordinal_position", table)
+	}
+
+	return nil, fmt.Errorf("listing primary keys is not supported for driver %q", driverForDB(db))
+}
+
+// queryColumn runs a query returning a single column and scans every row
+func queryColumn[T any](db *sql.DB, query string, args ...any) ([]T, error) {
+	query, args, err := RebindSQL(db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query %q failed: %w", query, err)
+	}
+	defer rows.Close()
+
+	result := []T{}
+	for rows.Next() {
+		var value T
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("query %q: failed to scan row: %w", query, err)
+		}
+		result = append(result, value)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query %q failed: %w", query, err)
+	}
+
+	return result, nil
+}
+
+// schemaColumn describes a table column as needed to generate valid values
+type schemaColumn struct {
+	name          string
+	dataType      string // lower case, without length, e.g. "varchar"
+	length        int    // maximum length of character columns, 0 if unknown
+	notNull       bool
+	primaryKey    bool
+	unique        bool
+	autoIncrement bool
+	hasDefault    bool
+}
+
+// schemaForeignKey is a column referencing a column of another table
+type schemaForeignKey struct {
+	column    string
+	refTable  string
+	refColumn string
+}
+
+// tableColumns returns the columns of a table in declaration order, with
+// their primary key, unique and auto increment flags
+func tableColumns(db *sql.DB, table string) ([]schemaColumn, error) {
+	dialect := DialectForDB(db).Name()
+
+	var columns []schemaColumn
+	var err error
+
+	switch dialect {
+	case DialectSQLite:
+		columns, err = sqliteTableColumns(db, table)
+	case DialectMySQL, DialectPostgres:
+		columns, err = informationSchemaColumns(db, dialect, table)
+	default:
+		return nil, fmt.Errorf("listing columns is not supported for driver %q", driverForDB(db))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %q not found or has no columns", table)
+	}
+
+	return columns, nil
+}
+
+// sqliteTableColumns reads the columns of a SQLite table
+func sqliteTableColumns(db *sql.DB, table string) ([]schemaColumn, error) {
+	rows, err := QueryMaps(db, "SELECT name, type, \"notnull\", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := []schemaColumn{}
+	primaryKeys := 0
+	for _, row := range rows {
+		dataType, length := parseColumnType(fmt.Sprint(row["type"]))
+		column := schemaColumn{
+			name:       fmt.Sprint(row["name"]),
+			dataType:   dataType,
+			length:     length,
+			notNull:    row["notnull"] == int64(1),
+			primaryKey: row["pk"] != int64(0),
+			hasDefault: row["dflt_value"] != nil,
+		}
+		if column.primaryKey {
+			primaryKeys++
+		}
+		columns = append(columns, column)
+	}
+
+	// A single INTEGER PRIMARY KEY column is an alias of the rowid
+	for i := range columns {
+		if columns[i].primaryKey && primaryKeys == 1 && columns[i].dataType == "integer" {
+			columns[i].autoIncrement = true
+		}
+	}
+
+	unique, err := queryColumn[string](db, "SELECT ii.name FROM pragma_index_list(?) il"+
+		" JOIN pragma_index_info(il.name) ii WHERE il.\"unique\" = 1 AND il.origin != 'pk'", table)
+	if err != nil {
+		return nil, err
+	}
+	markUnique(columns, unique)
+
+	return columns, nil
+}
+
+// informationSchemaColumns reads the columns of a MySQL or Postgres table
+func informationSchemaColumns(db *sql.DB, dialect string, table string) ([]schemaColumn, error) {
+	schema := currentSchemaSQL(dialect)
+
+	extra := "''"
+	if dialect == DialectMySQL {
+		extra = "extra"
+	}
+
+	rows, err := QueryMaps(db, "SELECT column_name AS name, data_type AS type, character_maximum_length AS length,"+
+		" is_nullable AS nullable, column_default AS dflt, "+extra+" AS extra"+
+		" FROM information_schema.columns WHERE table_schema = "+schema+" AND table_name = ? ORDER BY ordinal_position", table)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := []schemaColumn{}
+	for _, row := range rows {
+		dataType, _ := parseColumnType(fmt.Sprint(row["type"]))
+		defaultValue := fmt.Sprint(row["dflt"])
+		column := schemaColumn{
+			name:       fmt.Sprint(row["name"]),
+			dataType:   dataType,
+			notNull:    fmt.Sprint(row["nullable"]) == "NO",
+			hasDefault: row["dflt"] != nil,
+			autoIncrement: strings.Contains(fmt.Sprint(row["extra"]), "auto_increment") ||
+				strings.HasPrefix(defaultValue, "nextval("),
+		}
+		switch length := row["length"].(type) {
+		case int64:
+			column.length = int(length)
+		case string:
+			column.length, _ = strconv.Atoi(length)
+		}
+		columns = append(columns, column)
+	}
+
+	primaryKey, err := primaryKeyColumns(db, table)
+	if err != nil {
+		return nil, err
+	}
+	for i := range columns {
+		columns[i].primaryKey = slices.Contains(primaryKey, columns[i].name)
+	}
+
+	unique, err := queryColumn[string](db, "SELECT kcu.column_name FROM information_schema.table_constraints tc"+
+		" JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = tc.constraint_name"+
+		" AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name"+
+		" WHERE tc.constraint_type = 'UNIQUE' AND tc.table_schema = "+schema+" AND tc.table_name = ?", table)
+	if err != nil {
+		return nil, err
+	}
+	markUnique(columns, unique)
+
+	return columns, nil
+}
+
+// markUnique flags the named columns as unique
+func markUnique(columns []schemaColumn, names []string) {
+	for i := range columns {
+		if slices.Contains(names, columns[i].name) {
+			columns[i].unique = true
+		}
+	}
+}
+
+// parseColumnType splits a declared type such as "VARCHAR(255)" into its
+// lower case name and length
+func parseColumnType(declared string) (string, int) {
+	declared = strings.ToLower(strings.TrimSpace(declared))
+
+	name, args, hasArgs := strings.Cut(declared, "(")
+	name = strings.TrimSpace(name)
+	if !hasArgs {
+		return name, 0
+	}
+
+	length, _ := strconv.Atoi(strings.TrimSpace(strings.SplitN(strings.TrimSuffix(args, ")"), ",", 2)[0]))
+	return name, length
+}
+
+// foreignKeys returns the foreign keys of a table
+func foreignKeys(db *sql.DB, table string) ([]schemaForeignKey, error) {
+	dialect := DialectForDB(db).Name()
+
+	var query string
+	switch dialect {
+	case DialectSQLite:
+		query = "SELECT \"from\", \"table\", \"to\" FROM pragma_foreign_key_list(?)"
+	case DialectMySQL:
+		query = "SELECT column_name, referenced_table_name, referenced_column_name FROM information_schema.key_column_usage" +
+			" WHERE table_schema = DATABASE() AND table_name = ? AND referenced_table_name IS NOT NULL"
+	case DialectPostgres:
+		query = "SELECT kcu.column_name, ccu.table_name, ccu.column_name FROM information_schema.table_constraints tc" +
+			" JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema" +
+			" JOIN information_schema.constraint_column_usage ccu ON ccu.constraint_name = tc.constraint_name AND ccu.table_schema = tc.table_schema" +
+			" WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema() AND tc.table_name = ?"
+	default:
+		return nil, fmt.Errorf("listing foreign keys is not supported for driver %q", driverForDB(db))
+	}
+
+	_, rows, err := queryValues(db, query, table)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []schemaForeignKey{}
+	for _, row := range rows {
+		key := schemaForeignKey{column: fmt.Sprint(row[0]), refTable: fmt.Sprint(row[1])}
+
+		if row[2] != nil {
+			key.refColumn = fmt.Sprint(row[2])
+		} else {
+			// SQLite: REFERENCES parent without a column means its primary key
+			primaryKey, err := primaryKeyColumns(db, key.refTable)
+			if err != nil {
+				return nil, err
+			}
+			if len(primaryKey) != 1 {
+				return nil, fmt.Errorf("foreign key %s.%s references %s, which has no single column primary key", table, key.column, key.refTable)
+			}
+			key.refColumn = primaryKey[0]
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
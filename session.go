@@ -0,0 +1,188 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	urlpkg "net/url"
+)
+
+// DefaultSessionBaseURL is the URL in-process requests of a TestSession are
+// made to, matching the host httptest.NewRequest uses
+const DefaultSessionBaseURL = "http://example.com"
+
+// TestSession keeps cookies across in-process test calls like a browser,
+// so multi-step flows (e.g. login then access) can be tested. Cookies set by
+// responses are stored in a jar honoring Path, Domain, Expires, MaxAge and
+// Secure, and sent with the following requests they match.
+type TestSession struct {
+	// BaseURL is the scheme and host requests are made to, paths are
+	// resolved against it. Use an https URL to send Secure cookies.
+	// Defaults to DefaultSessionBaseURL.
+	BaseURL string
+
+	// Jar stores the cookies of the session
+	Jar http.CookieJar
+}
+
+// NewTestSession creates a session with an empty cookie jar
+func NewTestSession() *TestSession {
+	// A nil public suffix list never fails
+	jar, _ := cookiejar.New(nil)
+
+	return &TestSession{
+		BaseURL: DefaultSessionBaseURL,
+		Jar:     jar,
+	}
+}
+
+// CallEndpoint calls the handler like CallEndpoint with a request for url,
+// sending the session cookies and storing the cookies of the response
+func (s *TestSession) CallEndpoint(method string, url string, f func(w http.ResponseWriter, r *http.Request), options NewRequestOptions) (body string, response *http.Response, err error) {
+	return s.call(method, url, http.HandlerFunc(f), options)
+}
+
+// CallStringEndpoint calls the handler like CallStringEndpoint with a
+// request for url, sending the session cookies and storing the cookies of
+// the response
+func (s *TestSession) CallStringEndpoint(method string, url string, f func(w http.ResponseWriter, r *http.Request) string, options NewRequestOptions) (body string, response *http.Response, err error) {
+	return s.call(method, url, StringHandler(f), options)
+}
+
+// Execute executes the request like TestHTTPRequest.Execute, sending the
+// session cookies and storing the cookies of the response. Like
+// httptest.NewRequest, it panics if the request cannot be built.
+func (s *TestSession) Execute(r *TestHTTPRequest, handler http.Handler) *httptest.ResponseRecorder {
+	req := r.build()
+	defer req.Body.Close()
+
+	u, err := s.resolve(r.Path)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return s.serve(req, u, r.Host, handler)
+}
+
+// ExecuteT is like Execute but logs the request as a curl command and a raw
+// HTTP dump if the test fails, see LogRequestOnFailure
+func (s *TestSession) ExecuteT(t testing.TB, r *TestHTTPRequest, handler http.Handler) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := r.build()
+	defer req.Body.Close()
+
+	u, err := s.resolve(r.Path)
+	if err != nil {
+		t.Fatalf("failed to resolve %s: %v", r.Path, err)
+	}
+
+	LogRequestOnFailure(t, req)
+
+	return s.serve(req, u, r.Host, handler)
+}
+
+// Cookies returns the cookies the session sends to url
+func (s *TestSession) Cookies(url string) ([]*http.Cookie, error) {
+	u, err := s.resolve(url)
+	if err != nil {
+		return nil, err
+	}
+	return s.Jar.Cookies(u), nil
+}
+
+// Cookie returns the value of the named cookie the session sends to url,
+// and whether it is set
+func (s *TestSession) Cookie(url string, name string) (string, bool) {
+	cookies, err := s.Cookies(url)
+	if err != nil {
+		return "", false
+	}
+
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetCookies stores cookies as if a response from url had set them
+func (s *TestSession) SetCookies(url string, cookies ...*http.Cookie) error {
+	u, err := s.resolve(url)
+	if err != nil {
+		return err
+	}
+	s.Jar.SetCookies(u, cookies)
+	return nil
+}
+
+// call builds the request with NewRequest and serves it
+func (s *TestSession) call(method string, url string, handler http.Handler, options NewRequestOptions) (string, *http.Response, error) {
+	// The URL NewRequest uses
+	if url == "" {
+		url = options.URL
+	}
+
+	u, err := s.resolve(url)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, err := NewRequest(method, url, options)
+	if err != nil {
+		return "", nil, err
+	}
+	defer req.Body.Close()
+	defer releaseRequest(req)
+
+	recorder := s.serve(req, u, options.Host, handler)
+
+	return recorder.Body.String(), recorder.Result(), nil
+}
+
+// serve adds the cookies of the jar matching u, serves the request and
+// stores the cookies of the response. The Host of the request is the host
+// of u, unless the caller set host.
+func (s *TestSession) serve(req *http.Request, u *urlpkg.URL, host string, handler http.Handler) *httptest.ResponseRecorder {
+	if host == "" {
+		req.Host = u.Host
+	}
+	for _, cookie := range s.Jar.Cookies(u) {
+		req.AddCookie(cookie)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	s.Jar.SetCookies(u, recorder.Result().Cookies())
+
+	return recorder
+}
+
+// resolve returns the absolute URL of a request for url
+func (s *TestSession) resolve(url string) (*urlpkg.URL, error) {
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultSessionBaseURL
+	}
+
+	base, err := urlpkg.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session base URL: %w", err)
+	}
+
+	if url == "" {
+		url = "/"
+	}
+
+	ref, err := urlpkg.Parse(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request URL: %w", err)
+	}
+
+	return base.ResolveReference(ref), nil
+}
@@ -0,0 +1,200 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// sessionTestHandler logs in on /login, serves /account to logged in users
+// and logs out on /logout
+func sessionTestHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "admin", Value: "1", Path: "/admin"})
+		http.SetCookie(w, &http.Cookie{Name: "secure", Value: "1", Path: "/", Secure: true})
+		http.SetCookie(w, &http.Cookie{Name: "expired", Value: "1", Path: "/", Expires: time.Now().Add(-time.Hour)})
+		w.Write([]byte("logged in"))
+	})
+
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		if err != nil || cookie.Value != "abc" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("account"))
+	})
+
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Path: "/", MaxAge: -1})
+		w.Write([]byte("logged out"))
+	})
+
+	return mux
+}
+
+func TestNewRequestCookies(t *testing.T) {
+	req, err := NewRequest(http.MethodGet, "/", NewRequestOptions{
+		Cookies: []*http.Cookie{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	if got := req.Header.Get("Cookie"); got != "a=1; b=2" {
+		t.Errorf("Expected Cookie header %q, got %q", "a=1; b=2", got)
+	}
+}
+
+func TestTestHTTPRequestWithCookie(t *testing.T) {
+	recorder := NewTestHTTPRequest(http.MethodGet, "/account").
+		WithCookie(&http.Cookie{Name: "session", Value: "abc"}).
+		Execute(sessionTestHandler())
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestTestSessionLoginFlow(t *testing.T) {
+	session := NewTestSession()
+	handler := sessionTestHandler()
+
+	recorder := session.Execute(NewTestHTTPRequest(http.MethodGet, "/account"), handler)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status code %d before login, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+
+	session.Execute(NewTestHTTPRequest(http.MethodPost, "/login"), handler)
+
+	body, resp, err := session.CallEndpoint(http.MethodGet, "/account", handler.ServeHTTP, NewRequestOptions{})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || body != "account" {
+		t.Fatalf("Expected the account after login, got %d %q", resp.StatusCode, body)
+	}
+
+	// Path, Secure and Expires are honored
+	if _, ok := session.Cookie("/account", "admin"); ok {
+		t.Error("Expected the /admin cookie not to be sent to /account")
+	}
+	if value, ok := session.Cookie("/admin/users", "admin"); !ok || value != "1" {
+		t.Errorf("Expected the /admin cookie to be sent to /admin/users, got %q", value)
+	}
+	if _, ok := session.Cookie("/account", "secure"); ok {
+		t.Error("Expected the secure cookie not to be sent over http")
+	}
+	if _, ok := session.Cookie("/account", "expired"); ok {
+		t.Error("Expected the expired cookie not to be stored")
+	}
+
+	// MaxAge -1 deletes the cookie
+	session.Execute(NewTestHTTPRequest(http.MethodPost, "/logout"), handler)
+
+	recorder = session.Execute(NewTestHTTPRequest(http.MethodGet, "/account"), handler)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d after logout, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
+
+func TestTestSessionSecureAndDomain(t *testing.T) {
+	session := NewTestSession()
+	session.BaseURL = "https://www.example.com"
+
+	var received []*http.Cookie
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		received = r.Cookies()
+	}
+
+	err := session.SetCookies("/",
+		&http.Cookie{Name: "secure", Value: "1", Secure: true},
+		&http.Cookie{Name: "shared", Value: "1", Domain: "example.com"},
+	)
+	if err != nil {
+		t.Fatalf("SetCookies failed: %v", err)
+	}
+
+	if _, _, err := session.CallEndpoint(http.MethodGet, "/", handler, NewRequestOptions{}); err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 cookies over https, got %d", len(received))
+	}
+
+	// Domain cookies are shared with subdomains, host-only ones are not
+	if _, ok := session.Cookie("https://api.example.com/", "shared"); !ok {
+		t.Error("Expected the domain cookie to be sent to a subdomain")
+	}
+	if _, ok := session.Cookie("https://api.example.com/", "secure"); ok {
+		t.Error("Expected the host-only cookie not to be sent to another host")
+	}
+}
+
+func TestTestSessionHost(t *testing.T) {
+	session := NewTestSession()
+	session.BaseURL = "http://shop.test"
+
+	host := ""
+	session.Execute(NewTestHTTPRequest(http.MethodGet, "/"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+
+	if host != "shop.test" {
+		t.Errorf("Expected host %q, got %q", "shop.test", host)
+	}
+}
+
+func TestTestSessionExplicitHost(t *testing.T) {
+	session := NewTestSession()
+	session.BaseURL = "http://shop.test"
+
+	hostHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}
+
+	body, _, err := session.CallEndpoint(http.MethodGet, "/", hostHandler, NewRequestOptions{Host: "tenant.shop.test"})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if body != "tenant.shop.test" {
+		t.Errorf("Expected host %q, got %q", "tenant.shop.test", body)
+	}
+
+	recorder := session.Execute(NewTestHTTPRequest(http.MethodGet, "/").WithHost("admin.shop.test"), http.HandlerFunc(hostHandler))
+	if got := recorder.Body.String(); got != "admin.shop.test" {
+		t.Errorf("Expected host %q, got %q", "admin.shop.test", got)
+	}
+}
+
+func TestTestSessionOptionsURL(t *testing.T) {
+	session := NewTestSession()
+	if err := session.SetCookies("/admin", &http.Cookie{Name: "admin", Value: "1", Path: "/admin"}); err != nil {
+		t.Fatalf("SetCookies failed: %v", err)
+	}
+
+	body, _, err := session.CallEndpoint(http.MethodGet, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.Header.Get("Cookie")))
+	}, NewRequestOptions{URL: "http://shop.test/admin/users"})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+
+	// The cookie is set for example.com, not for the requested host
+	if body != "shop.test " {
+		t.Errorf("Expected the host and cookies of options.URL, got %q", body)
+	}
+
+	body, _, err = session.CallEndpoint(http.MethodGet, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.Header.Get("Cookie")))
+	}, NewRequestOptions{URL: "/admin/users"})
+	if err != nil {
+		t.Fatalf("CallEndpoint failed: %v", err)
+	}
+	if body != "example.com admin=1" {
+		t.Errorf("Expected the cookies matching options.URL, got %q", body)
+	}
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultSQLitePragmas returns the pragmas applied to file backed SQLite
+// test databases unless overridden in DBConfig.Pragmas
+func DefaultSQLitePragmas() map[string]string {
+	return map[string]string{
+		"journal_mode": "WAL",
+		"foreign_keys": "ON",
+		"busy_timeout": "5000",
+		"synchronous":  "NORMAL",
+	}
+}
+
+// sqliteDSN appends the configured pragmas to the SQLite DSN using the
+// "_pragma=name(value)" parameters understood by modernc.org/sqlite,
+// which applies them to every connection in the pool
+func sqliteDSN(database string, pragmas map[string]string) string {
+	if len(pragmas) == 0 {
+		return database
+	}
+
+	names := make([]string, 0, len(pragmas))
+	for name := range pragmas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := []string{}
+	for _, name := range names {
+		params = append(params, "_pragma="+url.QueryEscape(fmt.Sprintf("%s(%s)", name, pragmas[name])))
+	}
+
+	dsn := database
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+
+	return dsn + separator + strings.Join(params, "&")
+}
+
+// sqlitePragmas merges the configured pragmas over the defaults for file
+// backed databases
+func sqlitePragmas(config *DBConfig) map[string]string {
+	pragmas := map[string]string{}
+
+	if config.SQLiteFile {
+		for name, value := range DefaultSQLitePragmas() {
+			pragmas[name] = value
+		}
+	}
+
+	for name, value := range config.Pragmas {
+		pragmas[name] = value
+	}
+
+	return pragmas
+}
+
+// isSQLiteMemory reports whether the SQLite database name refers to an
+// in-memory database
+func isSQLiteMemory(database string) bool {
+	return database == "" || strings.Contains(database, ":memory:") || strings.Contains(database, "mode=memory")
+}
+
+// keepSQLiteFile copies a SQLite database file, together with its WAL and
+// shared memory files if present, to a new directory outside of the test's
+// temporary directory and returns the path of the copy
+func keepSQLiteFile(path string) (string, error) {
+	dir, err := os.MkdirTemp("", "dracory-test-db-")
+	if err != nil {
+		return "", err
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		source := path + suffix
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+
+		if err := copyFile(source, filepath.Join(dir, filepath.Base(source))); err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+func copyFile(source string, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	dsn := sqliteDSN("/tmp/test.db", map[string]string{"journal_mode": "WAL", "busy_timeout": "100"})
+	expected := "file:/tmp/test.db?_pragma=busy_timeout%28100%29&_pragma=journal_mode%28WAL%29"
+	if dsn != expected {
+		t.Errorf("Expected DSN %q, got %q", expected, dsn)
+	}
+
+	dsn = sqliteDSN("file::memory:?cache=shared", map[string]string{"foreign_keys": "ON"})
+	expected = "file::memory:?cache=shared&_pragma=foreign_keys%28ON%29"
+	if dsn != expected {
+		t.Errorf("Expected DSN %q, got %q", expected, dsn)
+	}
+
+	if dsn := sqliteDSN("file::memory:?cache=shared", nil); dsn != "file::memory:?cache=shared" {
+		t.Errorf("Expected DSN to be unchanged without pragmas, got %q", dsn)
+	}
+}
+
+func TestNewTestDBTSQLiteFile(t *testing.T) {
+	db := NewTestDBT(t, &DBConfig{
+		Driver:     "sqlite",
+		SQLiteFile: true,
+		Pragmas:    map[string]string{"synchronous": "FULL"},
+	})
+
+	// Force several connections, each must have the pragmas applied
+	db.SetMaxIdleConns(0)
+	for i := 0; i < 3; i++ {
+		var journalMode string
+		var foreignKeys int
+		var synchronous int
+		if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+			t.Fatalf("Failed to read journal_mode: %v", err)
+		}
+		if err := db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+			t.Fatalf("Failed to read foreign_keys: %v", err)
+		}
+		if err := db.QueryRow("PRAGMA synchronous").Scan(&synchronous); err != nil {
+			t.Fatalf("Failed to read synchronous: %v", err)
+		}
+		if journalMode != "wal" {
+			t.Errorf("Expected journal_mode wal, got %q", journalMode)
+		}
+		if foreignKeys != 1 {
+			t.Errorf("Expected foreign_keys 1, got %d", foreignKeys)
+		}
+		if synchronous != 2 {
+			t.Errorf("Expected synchronous 2 (FULL), got %d", synchronous)
+		}
+	}
+
+	var file string
+	if err := db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&file); err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Expected database file %q to exist: %v", file, err)
+	}
+}
+
+func TestNewTestDBSQLiteFileRequiresPath(t *testing.T) {
+	_, err := NewTestDB(&DBConfig{Driver: "sqlite", SQLiteFile: true})
+	if err == nil {
+		t.Errorf("Expected an error for SQLiteFile without a path")
+	}
+}
+
+func TestKeepSQLiteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	kept, err := keepSQLiteFile(path)
+	if err != nil {
+		t.Fatalf("keepSQLiteFile failed: %v", err)
+	}
+	defer os.RemoveAll(filepath.Dir(kept))
+
+	data, err := os.ReadFile(kept)
+	if err != nil {
+		t.Fatalf("Failed to read kept file: %v", err)
+	}
+	if string(data) != "data" {
+		t.Errorf("Expected kept file content %q, got %q", "data", string(data))
+	}
+}
@@ -0,0 +1,671 @@
+// Package sqlitecompat emulates common MySQL and Postgres functions in
+// SQLite test databases opened with the modernc.org/sqlite driver, so more
+// production SQL runs unchanged against test.NewTestDB. It is a separate
+// package so the test package itself does not depend on a SQLite driver.
+package sqlitecompat
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dracory/test"
+	"modernc.org/sqlite"
+)
+
+// SQLite date and time formats used by the functions, matching
+// CURRENT_TIMESTAMP, CURRENT_DATE and CURRENT_TIME
+const (
+	sqliteTimestampFormat = "2006-01-02 15:04:05"
+	sqliteDateFormat      = "2006-01-02"
+	sqliteTimeFormat      = "15:04:05"
+)
+
+var (
+	registerOnce sync.Once
+	registerErr  error
+
+	compatRegexps sync.Map
+
+	// clock is the clock set with SetClock, nil for the system time
+	clock atomic.Pointer[test.Clock]
+)
+
+// compatFunction is a MySQL/Postgres function emulated in SQLite
+type compatFunction struct {
+	name          string
+	args          int32 // -1 for variadic
+	deterministic bool
+	fn            func(args []driver.Value) (driver.Value, error)
+}
+
+// compatFunctions lists the emulated functions. Functions SQLite already
+// provides with compatible behaviour (CONCAT, CONCAT_WS, IF, COALESCE,
+// IFNULL, NULLIF, REPLACE, LOWER, UPPER, ...) are not included.
+var compatFunctions = []compatFunction{
+	// Date and time
+	{name: "now", args: 0, fn: compatNow},
+	{name: "sysdate", args: 0, fn: compatNow},
+	{name: "utc_timestamp", args: 0, fn: compatNow},
+	{name: "localtimestamp", args: 0, fn: compatNow},
+	{name: "curdate", args: 0, fn: compatCurDate},
+	{name: "utc_date", args: 0, fn: compatCurDate},
+	{name: "curtime", args: 0, fn: compatCurTime},
+	{name: "unix_timestamp", args: -1, fn: compatUnixTimestamp},
+	{name: "from_unixtime", args: 1, deterministic: true, fn: compatFromUnixTime},
+	{name: "date_format", args: 2, deterministic: true, fn: compatDateFormat},
+	{name: "to_char", args: 2, deterministic: true, fn: compatToChar},
+	{name: "date_trunc", args: 2, deterministic: true, fn: compatDateTrunc},
+	{name: "datediff", args: 2, deterministic: true, fn: compatDateDiff},
+	{name: "last_day", args: 1, deterministic: true, fn: compatLastDay},
+	{name: "year", args: 1, deterministic: true, fn: compatDatePart(func(t time.Time) int { return t.Year() })},
+	{name: "month", args: 1, deterministic: true, fn: compatDatePart(func(t time.Time) int { return int(t.Month()) })},
+	{name: "day", args: 1, deterministic: true, fn: compatDatePart(func(t time.Time) int { return t.Day() })},
+	{name: "dayofmonth", args: 1, deterministic: true, fn: compatDatePart(func(t time.Time) int { return t.Day() })},
+	{name: "hour", args: 1, deterministic: true, fn: compatDatePart(func(t time.Time) int { return t.Hour() })},
+	{name: "minute", args: 1, deterministic: true, fn: compatDatePart(func(t time.Time) int { return t.Minute() })},
+	{name: "second", args: 1, deterministic: true, fn: compatDatePart(func(t time.Time) int { return t.Second() })},
+
+	// Comparison
+	{name: "greatest", args: -1, deterministic: true, fn: compatExtreme(1)},
+	{name: "least", args: -1, deterministic: true, fn: compatExtreme(-1)},
+
+	// Strings
+	{name: "lpad", args: -1, deterministic: true, fn: compatPad(true)},
+	{name: "rpad", args: -1, deterministic: true, fn: compatPad(false)},
+	{name: "left", args: 2, deterministic: true, fn: compatLeft},
+	{name: "right", args: 2, deterministic: true, fn: compatRight},
+	{name: "repeat", args: 2, deterministic: true, fn: compatRepeat},
+	{name: "reverse", args: 1, deterministic: true, fn: compatReverse},
+	{name: "split_part", args: 3, deterministic: true, fn: compatSplitPart},
+	{name: "char_length", args: 1, deterministic: true, fn: compatCharLength},
+	{name: "character_length", args: 1, deterministic: true, fn: compatCharLength},
+	{name: "md5", args: 1, deterministic: true, fn: compatMD5},
+	{name: "regexp", args: 2, deterministic: true, fn: compatRegexp},
+	{name: "uuid", args: 0, fn: compatUUID},
+	{name: "gen_random_uuid", args: 0, fn: compatUUID},
+}
+
+// Register registers user-defined functions emulating common MySQL and
+// Postgres functions (NOW, CURDATE, UNIX_TIMESTAMP, DATE_FORMAT, TO_CHAR,
+// DATE_TRUNC, DATEDIFF, YEAR/MONTH/DAY, GREATEST, LEAST, LPAD, RPAD, LEFT,
+// RIGHT, SPLIT_PART, MD5, UUID, REGEXP and more) under their own names.
+//
+// The modernc.org/sqlite driver only supports process wide registration,
+// so the functions are available to every modernc.org/sqlite connection
+// the process opens afterwards, not only to test databases. Call it once,
+// e.g. from TestMain. Calling it again is a no-op.
+//
+// Queries are not rewritten: SQLite keywords such as CURRENT_TIMESTAMP and
+// operators such as ILIKE (use LIKE, which SQLite matches case
+// insensitively for ASCII) cannot be emulated. Timestamps are returned as
+// UTC text in the format of CURRENT_TIMESTAMP. GREATEST and LEAST ignore
+// NULL arguments like Postgres does.
+func Register() error {
+	registerOnce.Do(func() {
+		for _, f := range compatFunctions {
+			fn := f.fn
+			impl := func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+				return fn(args)
+			}
+
+			var err error
+			if f.deterministic {
+				err = sqlite.RegisterDeterministicScalarFunction(f.name, f.args, impl)
+			} else {
+				err = sqlite.RegisterScalarFunction(f.name, f.args, impl)
+			}
+
+			if err != nil {
+				registerErr = fmt.Errorf("failed to register SQLite compatibility function %s: %w", f.name, err)
+				return
+			}
+		}
+	})
+
+	return registerErr
+}
+
+// SetClock makes NOW(), CURDATE(), UNIX_TIMESTAMP() and the other emulated
+// current date functions return the time of clock, so rows inserted with
+// them get predictable timestamps. A nil clock restores the system time.
+//
+// Like the functions, the clock is shared by the whole process, so tests
+// setting it must not run in parallel. SQLite's own CURRENT_TIMESTAMP,
+// datetime('now') and column DEFAULTs keep the wall time.
+func SetClock(c *test.Clock) {
+	clock.Store(c)
+}
+
+// currentTime returns the current time for the emulated date functions
+func currentTime() time.Time {
+	// A nil *test.Clock reads the system time
+	return clock.Load().Now().UTC()
+}
+
+func compatNow(args []driver.Value) (driver.Value, error) {
+	return currentTime().Format(sqliteTimestampFormat), nil
+}
+
+func compatCurDate(args []driver.Value) (driver.Value, error) {
+	return currentTime().Format(sqliteDateFormat), nil
+}
+
+func compatCurTime(args []driver.Value) (driver.Value, error) {
+	return currentTime().Format(sqliteTimeFormat), nil
+}
+
+func compatUnixTimestamp(args []driver.Value) (driver.Value, error) {
+	switch len(args) {
+	case 0:
+		return currentTime().Unix(), nil
+	case 1:
+		if args[0] == nil {
+			return nil, nil
+		}
+		t, err := compatTime(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return t.Unix(), nil
+	}
+	return nil, fmt.Errorf("unix_timestamp: expected 0 or 1 arguments, got %d", len(args))
+}
+
+func compatFromUnixTime(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	seconds, err := compatInt(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("from_unixtime: %w", err)
+	}
+	return time.Unix(seconds, 0).UTC().Format(sqliteTimestampFormat), nil
+}
+
+// mysqlDateFormats maps MySQL DATE_FORMAT specifiers onto Go layouts
+var mysqlDateFormats = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'c': "1", 'd': "02", 'e': "2",
+	'H': "15", 'h': "03", 'I': "03", 'l': "3", 'i': "04", 's': "05", 'S': "05",
+	'f': "000000", 'p': "PM", 'M': "January", 'b': "Jan", 'W': "Monday",
+	'a': "Mon", 'T': "15:04:05", 'r': "03:04:05 PM",
+}
+
+func compatDateFormat(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	t, err := compatTime(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("date_format: %w", err)
+	}
+
+	format := compatString(args[1])
+
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch spec := format[i]; spec {
+		case 'k':
+			b.WriteString(strconv.Itoa(t.Hour()))
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		default:
+			if layout, ok := mysqlDateFormats[spec]; ok {
+				b.WriteString(t.Format(layout))
+			} else {
+				b.WriteByte(spec)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+// postgresDateFormats maps Postgres TO_CHAR patterns onto Go layouts,
+// longest patterns first
+var postgresDateFormats = []struct{ pattern, layout string }{
+	{"YYYY", "2006"}, {"HH24", "15"}, {"HH12", "03"}, {"Month", "January"},
+	{"Mon", "Jan"}, {"Day", "Monday"}, {"Dy", "Mon"}, {"YY", "06"},
+	{"MM", "01"}, {"DD", "02"}, {"HH", "03"}, {"MI", "04"}, {"SS", "05"},
+	{"MS", "000"}, {"US", "000000"}, {"AM", "PM"}, {"PM", "PM"},
+}
+
+func compatToChar(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	t, err := compatTime(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("to_char: %w", err)
+	}
+
+	format := compatString(args[1])
+
+	var b strings.Builder
+	for i := 0; i < len(format); {
+		matched := false
+		for _, f := range postgresDateFormats {
+			if strings.HasPrefix(format[i:], f.pattern) {
+				b.WriteString(t.Format(f.layout))
+				i += len(f.pattern)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(format[i])
+			i++
+		}
+	}
+
+	return b.String(), nil
+}
+
+func compatDateTrunc(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	t, err := compatTime(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("date_trunc: %w", err)
+	}
+
+	year, month, day := t.Date()
+
+	switch unit := strings.ToLower(compatString(args[0])); unit {
+	case "second":
+		t = t.Truncate(time.Second)
+	case "minute":
+		t = t.Truncate(time.Minute)
+	case "hour":
+		t = t.Truncate(time.Hour)
+	case "day":
+		t = time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7 // weeks start on Monday
+		t = time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case "month":
+		t = time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	case "quarter":
+		t = time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		t = time.Date(year, 1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return nil, fmt.Errorf("date_trunc: unsupported unit %q", unit)
+	}
+
+	return t.Format(sqliteTimestampFormat), nil
+}
+
+func compatDateDiff(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	var days [2]int64
+	for i, arg := range args {
+		t, err := compatTime(arg)
+		if err != nil {
+			return nil, fmt.Errorf("datediff: %w", err)
+		}
+		year, month, day := t.Date()
+		days[i] = time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	}
+
+	return days[0] - days[1], nil
+}
+
+func compatLastDay(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	t, err := compatTime(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("last_day: %w", err)
+	}
+
+	year, month, _ := t.Date()
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Format(sqliteDateFormat), nil
+}
+
+// compatDatePart returns a function extracting a part of a date, such as
+// YEAR(created_at)
+func compatDatePart(part func(time.Time) int) func(args []driver.Value) (driver.Value, error) {
+	return func(args []driver.Value) (driver.Value, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+
+		t, err := compatTime(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return int64(part(t)), nil
+	}
+}
+
+// compatExtreme returns GREATEST (sign 1) or LEAST (sign -1). NULL
+// arguments are ignored; numbers compare numerically, anything else as text.
+func compatExtreme(sign int) func(args []driver.Value) (driver.Value, error) {
+	return func(args []driver.Value) (driver.Value, error) {
+		var result driver.Value
+
+		for _, arg := range args {
+			if arg == nil {
+				continue
+			}
+			if result == nil || compareCompatValues(arg, result)*sign > 0 {
+				result = arg
+			}
+		}
+
+		return result, nil
+	}
+}
+
+// compareCompatValues compares two non-NULL SQLite values
+func compareCompatValues(a driver.Value, b driver.Value) int {
+	af, aNumber := compatNumber(a)
+	bf, bNumber := compatNumber(b)
+
+	if aNumber && bNumber {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(compatString(a), compatString(b))
+}
+
+// compatPad returns LPAD (left true) or RPAD. Like MySQL and Postgres, the
+// result is truncated to the length if the string is longer.
+func compatPad(left bool) func(args []driver.Value) (driver.Value, error) {
+	return func(args []driver.Value) (driver.Value, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("expected 2 or 3 arguments, got %d", len(args))
+		}
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+		}
+
+		s := []rune(compatString(args[0]))
+		length, err := compatInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		pad := []rune(" ")
+		if len(args) == 3 {
+			pad = []rune(compatString(args[2]))
+		}
+
+		if length <= 0 {
+			return "", nil
+		}
+		if int64(len(s)) >= length {
+			return string(s[:length]), nil
+		}
+		if len(pad) == 0 {
+			return string(s), nil
+		}
+
+		padding := make([]rune, 0, length-int64(len(s)))
+		for i := 0; int64(len(padding)) < length-int64(len(s)); i++ {
+			padding = append(padding, pad[i%len(pad)])
+		}
+
+		if left {
+			return string(padding) + string(s), nil
+		}
+		return string(s) + string(padding), nil
+	}
+}
+
+func compatLeft(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	s := []rune(compatString(args[0]))
+	n, err := compatInt(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("left: %w", err)
+	}
+
+	// Postgres: a negative length returns all but the last |n| characters
+	if n < 0 {
+		n += int64(len(s))
+	}
+
+	return string(s[:min(max(n, 0), int64(len(s)))]), nil
+}
+
+func compatRight(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	s := []rune(compatString(args[0]))
+	n, err := compatInt(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("right: %w", err)
+	}
+
+	// Postgres: a negative length returns all but the first |n| characters
+	if n < 0 {
+		n += int64(len(s))
+	}
+
+	n = min(max(n, 0), int64(len(s)))
+	return string(s[int64(len(s))-n:]), nil
+}
+
+func compatRepeat(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	n, err := compatInt(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("repeat: %w", err)
+	}
+
+	return strings.Repeat(compatString(args[0]), int(max(n, 0))), nil
+}
+
+func compatReverse(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	s := []rune(compatString(args[0]))
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+
+	return string(s), nil
+}
+
+func compatSplitPart(args []driver.Value) (driver.Value, error) {
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+	}
+
+	n, err := compatInt(args[2])
+	if err != nil {
+		return nil, fmt.Errorf("split_part: %w", err)
+	}
+
+	parts := strings.Split(compatString(args[0]), compatString(args[1]))
+
+	switch {
+	case n == 0:
+		return nil, fmt.Errorf("split_part: field position must not be zero")
+	case n < 0:
+		n += int64(len(parts)) + 1 // counted from the end
+	}
+
+	if n < 1 || n > int64(len(parts)) {
+		return "", nil
+	}
+
+	return parts[n-1], nil
+}
+
+func compatCharLength(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	return int64(utf8.RuneCountInString(compatString(args[0]))), nil
+}
+
+func compatMD5(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	sum := md5.Sum([]byte(compatString(args[0])))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// compatRegexp implements the REGEXP operator (value REGEXP pattern, which
+// SQLite calls as regexp(pattern, value)) with Go regular expressions
+func compatRegexp(args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	pattern := compatString(args[0])
+
+	re, ok := compatRegexps.Load(pattern)
+	if !ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("regexp: %w", err)
+		}
+		re, _ = compatRegexps.LoadOrStore(pattern, compiled)
+	}
+
+	if re.(*regexp.Regexp).MatchString(compatString(args[1])) {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+func compatUUID(args []driver.Value) (driver.Value, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// compatTimeLayouts are the layouts date arguments are parsed with
+var compatTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	sqliteDateFormat,
+}
+
+// compatTime converts a date argument (text, or a unix timestamp) to a time
+func compatTime(value driver.Value) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))).UTC(), nil
+	}
+
+	s := strings.TrimSpace(compatString(value))
+	for _, layout := range compatTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// compatString converts a value to text like SQLite does
+func compatString(value driver.Value) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(sqliteTimestampFormat)
+	}
+	return fmt.Sprint(value)
+}
+
+// compatNumber converts a numeric value to a float64
+func compatNumber(value driver.Value) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// compatInt converts a value to an integer like SQLite does
+func compatInt(value driver.Value) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	}
+
+	s := strings.TrimSpace(compatString(value))
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return int64(f), nil
+	}
+
+	return 0, fmt.Errorf("invalid integer %q", s)
+}
@@ -0,0 +1,144 @@
+package sqlitecompat
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/test"
+)
+
+func newCompatDB(t *testing.T, name string) *test.DBConfig {
+	t.Helper()
+
+	if err := Register(); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	return &test.DBConfig{Driver: "sqlite", Database: "file:" + name + "?mode=memory&cache=shared"}
+}
+
+func TestFunctions(t *testing.T) {
+	db := test.NewTestDBT(t, newCompatDB(t, "sqlitecompat_functions"))
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT CONCAT('a', 'b', 'c')", "abc"},
+		{"SELECT GREATEST(3, 10, NULL, 7)", "10"},
+		{"SELECT LEAST('pear', 'apple', 'fig')", "apple"},
+		{"SELECT DATE_FORMAT('2024-03-05 14:07:09', '%Y/%m/%d %H:%i:%s %W')", "2024/03/05 14:07:09 Tuesday"},
+		{"SELECT TO_CHAR('2024-03-05 14:07:09', 'DD Mon YYYY HH24:MI')", "05 Mar 2024 14:07"},
+		{"SELECT DATE_TRUNC('month', '2024-03-05 14:07:09')", "2024-03-01 00:00:00"},
+		{"SELECT DATE_TRUNC('week', '2024-03-07')", "2024-03-04 00:00:00"},
+		{"SELECT DATEDIFF('2024-03-05 23:00:00', '2024-02-28')", "6"},
+		{"SELECT LAST_DAY('2024-02-10')", "2024-02-29"},
+		{"SELECT YEAR('2024-03-05') || '-' || MONTH('2024-03-05') || '-' || DAY('2024-03-05')", "2024-3-5"},
+		{"SELECT UNIX_TIMESTAMP('1970-01-02 00:00:00')", "86400"},
+		{"SELECT FROM_UNIXTIME(86400)", "1970-01-02 00:00:00"},
+		{"SELECT LPAD('7', 3, '0') || RPAD('ab', 4, '.')", "007ab.."},
+		{"SELECT LEFT('héllo', 2) || RIGHT('héllo', 3)", "héllo"},
+		{"SELECT SPLIT_PART('a,b,c', ',', 2)", "b"},
+		{"SELECT REPEAT('ab', 3) || REVERSE('xyz')", "abababzyx"},
+		{"SELECT CHAR_LENGTH('héllo')", "5"},
+		{"SELECT MD5('hello')", "5d41402abc4b2a76b9719d911017c592"},
+		{"SELECT 'ABC-123' REGEXP '^[A-Z]+-[0-9]+$'", "1"},
+	}
+
+	for _, tt := range tests {
+		got, err := test.QueryScalar[string](db, tt.query)
+		if err != nil {
+			t.Errorf("%s failed: %v", tt.query, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.query, tt.expected, got)
+		}
+	}
+
+	now, err := test.QueryScalar[string](db, "SELECT NOW()")
+	if err != nil {
+		t.Fatalf("NOW() failed: %v", err)
+	}
+	if parsed, err := time.Parse(sqliteTimestampFormat, now); err != nil || time.Since(parsed) > time.Minute {
+		t.Errorf("Expected NOW() to return the current time, got %q", now)
+	}
+
+	uuid, err := test.QueryScalar[string](db, "SELECT UUID()")
+	if err != nil {
+		t.Fatalf("UUID() failed: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(uuid) {
+		t.Errorf("Expected a version 4 UUID, got %q", uuid)
+	}
+}
+
+func TestQueriesRunUnchanged(t *testing.T) {
+	db := test.NewTestDBT(t, newCompatDB(t, "sqlitecompat_names"))
+
+	// Names shared with the functions are left alone
+	statements := []string{
+		"CREATE TABLE day (left TEXT, year INTEGER)",
+		"INSERT INTO main.day (left, year) VALUES ('a', 2024)",
+		`INSERT INTO "day" (left, year) VALUES ('b', 2025)`,
+	}
+	for _, statement := range statements {
+		if err := test.ExecuteSQL(db, statement); err != nil {
+			t.Fatalf("%s failed: %v", statement, err)
+		}
+	}
+
+	got, err := test.QueryScalar[string](db, "WITH month(x) AS (SELECT MAX(year) FROM day) SELECT LEFT(x, 2) FROM month")
+	if err != nil || got != "20" {
+		t.Errorf("Expected the CTE to run, got %q (%v)", got, err)
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	clock := test.NewFrozenClock(time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	db := test.NewTestDBT(t, newCompatDB(t, "sqlitecompat_clock"))
+
+	if err := test.ExecuteSQL(db, "CREATE TABLE events (id INTEGER PRIMARY KEY, created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := test.ExecuteSQL(db, "INSERT INTO events (id, created_at) VALUES (1, NOW())"); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if err := test.ExecuteSQL(db, "INSERT INTO events (id, created_at) VALUES (2, NOW())"); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	created, err := test.QueryScalar[string](db, "SELECT group_concat(created_at, ',') FROM (SELECT created_at FROM events ORDER BY id)")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if created != "2024-03-05 14:07:09,2024-03-06 14:07:09" {
+		t.Errorf("Expected timestamps from the clock, got %v", created)
+	}
+
+	today, err := test.QueryScalar[string](db, "SELECT CURDATE() || ' ' || UNIX_TIMESTAMP()")
+	if err != nil || today != "2024-03-06 1709734029" {
+		t.Errorf("Expected CURDATE() and UNIX_TIMESTAMP() from the clock, got %q (%v)", today, err)
+	}
+
+	// Column DEFAULTs are SQLite's own and keep the wall time
+	if err := test.ExecuteSQL(db, "INSERT INTO events (id) VALUES (3)"); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	wall, err := test.QueryScalar[string](db, "SELECT created_at FROM events WHERE id = 3")
+	if err != nil || strings.HasPrefix(wall, "2024-03-06") {
+		t.Errorf("Expected the default to use the wall time, got %q (%v)", wall, err)
+	}
+
+	SetClock(nil)
+	if now, err := test.QueryScalar[string](db, "SELECT CURDATE()"); err != nil || now != time.Now().UTC().Format(sqliteDateFormat) {
+		t.Errorf("Expected the system time without a clock, got %q (%v)", now, err)
+	}
+}
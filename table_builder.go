@@ -0,0 +1,501 @@
+package test
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Supported SQL dialect names. Driver names such as "pgx" or "sqlite3" are
+// mapped onto one of these by normalizeDriver.
+const (
+	DialectSQLite   = "sqlite"
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+)
+
+// normalizeDriver maps a database/sql driver name onto the SQL dialect it speaks
+func normalizeDriver(driver string) string {
+	switch strings.ToLower(driver) {
+	case "sqlite", "sqlite3", "libsql":
+		return DialectSQLite
+	case "mysql":
+		return DialectMySQL
+	case "postgres", "postgresql", "pgx", "pq":
+		return DialectPostgres
+	}
+	return ""
+}
+
+// dbDrivers remembers the driver each database returned by NewTestDB was
+// opened with, so helpers taking only a *sql.DB can render dialect specific SQL
+var dbDrivers sync.Map
+
+// driverForDB returns the driver name the database was opened with. Databases
+// not created by NewTestDB are recognised by the type of their driver.
+func driverForDB(db *sql.DB) string {
+	if db == nil {
+		return ""
+	}
+
+	if driver, ok := dbDrivers.Load(db); ok {
+		return driver.(string)
+	}
+
+	driverType := strings.ToLower(fmt.Sprintf("%T", db.Driver()))
+	switch {
+	case strings.Contains(driverType, "sqlite"), strings.Contains(driverType, "libsql"):
+		return DialectSQLite
+	case strings.Contains(driverType, "mysql"):
+		return DialectMySQL
+	case strings.Contains(driverType, "pq."), strings.Contains(driverType, "stdlib."), strings.Contains(driverType, "pgx"):
+		return DialectPostgres
+	}
+	return ""
+}
+
+// quoteIdentifier quotes a table or column name for the given dialect
+func quoteIdentifier(dialect string, name string) string {
+	if dialect == DialectMySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteIdentifiers quotes and joins a list of column names
+func quoteIdentifiers(dialect string, names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(dialect, name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// quoteLiteral renders a Go value as an SQL literal for the given dialect
+func quoteLiteral(dialect string, value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case SQLExpr:
+		return string(v), nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case bool:
+		if dialect == DialectPostgres {
+			if v {
+				return "TRUE", nil
+			}
+			return "FALSE", nil
+		}
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("unsupported literal type %T", value)
+}
+
+// SQLExpr is a raw SQL expression, used where a value would otherwise be
+// quoted as a literal (for example Default(SQLExpr("CURRENT_TIMESTAMP")))
+type SQLExpr string
+
+// Column types understood by the table builder
+const (
+	ColumnInteger   = "integer"
+	ColumnString    = "string"
+	ColumnText      = "text"
+	ColumnBool      = "bool"
+	ColumnTimestamp = "timestamp"
+	ColumnDecimal   = "decimal"
+	ColumnJSON      = "json"
+)
+
+// TableBuilder builds a CREATE TABLE statement that can be rendered for
+// any of the supported dialects, so a test schema is written once and
+// works against sqlite, mysql and postgres alike
+type TableBuilder struct {
+	name        string
+	columns     []*ColumnBuilder
+	primaryKey  []string
+	indexes     []tableIndex
+	foreignKeys []*ForeignKeyBuilder
+}
+
+type tableIndex struct {
+	columns []string
+	unique  bool
+}
+
+// NewTableBuilder creates a new table builder for the named table
+func NewTableBuilder(name string) *TableBuilder {
+	return &TableBuilder{name: name}
+}
+
+// Name returns the name of the table
+func (t *TableBuilder) Name() string {
+	return t.name
+}
+
+// Integer adds an integer column
+func (t *TableBuilder) Integer(name string) *ColumnBuilder {
+	return t.addColumn(name, ColumnInteger)
+}
+
+// String adds a variable length string column. Prefer String over Text for
+// columns that are indexed, as MySQL cannot index TEXT without a length.
+func (t *TableBuilder) String(name string, length int) *ColumnBuilder {
+	column := t.addColumn(name, ColumnString)
+	column.length = length
+	return column
+}
+
+// Text adds a text column
+func (t *TableBuilder) Text(name string) *ColumnBuilder {
+	return t.addColumn(name, ColumnText)
+}
+
+// Bool adds a boolean column
+func (t *TableBuilder) Bool(name string) *ColumnBuilder {
+	return t.addColumn(name, ColumnBool)
+}
+
+// Timestamp adds a date and time column
+func (t *TableBuilder) Timestamp(name string) *ColumnBuilder {
+	return t.addColumn(name, ColumnTimestamp)
+}
+
+// Decimal adds a fixed point decimal column
+func (t *TableBuilder) Decimal(name string, precision int, scale int) *ColumnBuilder {
+	column := t.addColumn(name, ColumnDecimal)
+	column.precision = precision
+	column.scale = scale
+	return column
+}
+
+// JSON adds a JSON column (TEXT on sqlite, JSON on mysql, JSONB on postgres)
+func (t *TableBuilder) JSON(name string) *ColumnBuilder {
+	return t.addColumn(name, ColumnJSON)
+}
+
+// PrimaryKey sets a (possibly composite) primary key on the table
+func (t *TableBuilder) PrimaryKey(columns ...string) *TableBuilder {
+	t.primaryKey = columns
+	return t
+}
+
+// Index adds an index on the given columns
+func (t *TableBuilder) Index(columns ...string) *TableBuilder {
+	t.indexes = append(t.indexes, tableIndex{columns: columns})
+	return t
+}
+
+// UniqueIndex adds a unique index on the given columns
+func (t *TableBuilder) UniqueIndex(columns ...string) *TableBuilder {
+	t.indexes = append(t.indexes, tableIndex{columns: columns, unique: true})
+	return t
+}
+
+// ForeignKey adds a foreign key on the given column
+func (t *TableBuilder) ForeignKey(column string) *ForeignKeyBuilder {
+	foreignKey := &ForeignKeyBuilder{column: column}
+	t.foreignKeys = append(t.foreignKeys, foreignKey)
+	return foreignKey
+}
+
+func (t *TableBuilder) addColumn(name string, columnType string) *ColumnBuilder {
+	column := &ColumnBuilder{name: name, columnType: columnType, nullable: true}
+	t.columns = append(t.columns, column)
+	return column
+}
+
+// SQL renders the statements needed to create the table for the given
+// driver: the CREATE TABLE statement followed by any CREATE INDEX statements
+func (t *TableBuilder) SQL(driver string) ([]string, error) {
+	return t.statements(driver, t.name)
+}
+
+func (t *TableBuilder) statements(driver string, tableName string) ([]string, error) {
+	dialect := normalizeDriver(driver)
+	if dialect == "" {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+
+	if tableName == "" {
+		return nil, fmt.Errorf("table name must be provided")
+	}
+
+	if len(t.columns) == 0 {
+		return nil, fmt.Errorf("table %s has no columns", tableName)
+	}
+
+	primaryKey := t.primaryKey
+	if len(primaryKey) == 0 {
+		for _, column := range t.columns {
+			if column.primary {
+				primaryKey = append(primaryKey, column.name)
+			}
+		}
+	}
+
+	inlinePrimaryKey := ""
+	if len(primaryKey) == 1 {
+		inlinePrimaryKey = primaryKey[0]
+	}
+
+	definitions := []string{}
+	for _, column := range t.columns {
+		definition, err := column.definition(dialect, column.name == inlinePrimaryKey)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", tableName, err)
+		}
+		definitions = append(definitions, definition)
+	}
+
+	if len(primaryKey) > 1 {
+		definitions = append(definitions, "PRIMARY KEY ("+quoteIdentifiers(dialect, primaryKey)+")")
+	}
+
+	for _, foreignKey := range t.foreignKeys {
+		definition, err := foreignKey.definition(dialect)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", tableName, err)
+		}
+		definitions = append(definitions, definition)
+	}
+
+	statements := []string{}
+	indexStatements := []string{}
+
+	for _, index := range t.indexes {
+		if len(index.columns) == 0 {
+			return nil, fmt.Errorf("table %s: index requires at least one column", tableName)
+		}
+
+		prefix := "idx"
+		if index.unique {
+			prefix = "uniq"
+		}
+		name := prefix + "_" + tableName + "_" + strings.Join(index.columns, "_")
+
+		unique := ""
+		if index.unique {
+			unique = "UNIQUE "
+		}
+
+		// MySQL has no CREATE INDEX IF NOT EXISTS, so indexes are declared
+		// inline to keep the statement repeatable
+		if dialect == DialectMySQL {
+			definitions = append(definitions, fmt.Sprintf("%sINDEX %s (%s)",
+				unique, quoteIdentifier(dialect, name), quoteIdentifiers(dialect, index.columns)))
+			continue
+		}
+
+		indexStatements = append(indexStatements, fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)",
+			unique, quoteIdentifier(dialect, name), quoteIdentifier(dialect, tableName), quoteIdentifiers(dialect, index.columns)))
+	}
+
+	statements = append(statements, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)",
+		quoteIdentifier(dialect, tableName), strings.Join(definitions, ", ")))
+
+	return append(statements, indexStatements...), nil
+}
+
+// ColumnBuilder describes a single column of a TableBuilder
+type ColumnBuilder struct {
+	name          string
+	columnType    string
+	length        int
+	precision     int
+	scale         int
+	nullable      bool
+	primary       bool
+	autoIncrement bool
+	unique        bool
+	hasDefault    bool
+	defaultValue  any
+}
+
+// NotNull marks the column as NOT NULL
+func (c *ColumnBuilder) NotNull() *ColumnBuilder {
+	c.nullable = false
+	return c
+}
+
+// Nullable marks the column as nullable (the default)
+func (c *ColumnBuilder) Nullable() *ColumnBuilder {
+	c.nullable = true
+	return c
+}
+
+// PrimaryKey marks the column as (part of) the primary key
+func (c *ColumnBuilder) PrimaryKey() *ColumnBuilder {
+	c.primary = true
+	c.nullable = false
+	return c
+}
+
+// AutoIncrement marks an integer primary key column as auto incrementing
+func (c *ColumnBuilder) AutoIncrement() *ColumnBuilder {
+	c.autoIncrement = true
+	return c.PrimaryKey()
+}
+
+// Unique adds a UNIQUE constraint to the column
+func (c *ColumnBuilder) Unique() *ColumnBuilder {
+	c.unique = true
+	return c
+}
+
+// Default sets the default value of the column. Strings are quoted as
+// literals, use SQLExpr for raw expressions.
+func (c *ColumnBuilder) Default(value any) *ColumnBuilder {
+	c.hasDefault = true
+	c.defaultValue = value
+	return c
+}
+
+// DefaultCurrentTimestamp sets the default value of the column to CURRENT_TIMESTAMP
+func (c *ColumnBuilder) DefaultCurrentTimestamp() *ColumnBuilder {
+	return c.Default(SQLExpr("CURRENT_TIMESTAMP"))
+}
+
+func (c *ColumnBuilder) sqlType(dialect string) string {
+	switch c.columnType {
+	case ColumnInteger:
+		if dialect == DialectMySQL {
+			if c.autoIncrement {
+				return "BIGINT"
+			}
+			return "INT"
+		}
+		if dialect == DialectPostgres && c.autoIncrement {
+			return "BIGSERIAL"
+		}
+		return "INTEGER"
+	case ColumnString:
+		length := c.length
+		if length <= 0 {
+			length = 255
+		}
+		return fmt.Sprintf("VARCHAR(%d)", length)
+	case ColumnText:
+		return "TEXT"
+	case ColumnBool:
+		if dialect == DialectMySQL {
+			return "TINYINT(1)"
+		}
+		return "BOOLEAN"
+	case ColumnTimestamp:
+		if dialect == DialectPostgres {
+			return "TIMESTAMP"
+		}
+		return "DATETIME"
+	case ColumnDecimal:
+		precision := c.precision
+		if precision <= 0 {
+			precision = 10
+		}
+		return fmt.Sprintf("DECIMAL(%d,%d)", precision, c.scale)
+	case ColumnJSON:
+		switch dialect {
+		case DialectMySQL:
+			return "JSON"
+		case DialectPostgres:
+			return "JSONB"
+		}
+		return "TEXT"
+	}
+	return ""
+}
+
+func (c *ColumnBuilder) definition(dialect string, inlinePrimaryKey bool) (string, error) {
+	if c.autoIncrement {
+		if c.columnType != ColumnInteger {
+			return "", fmt.Errorf("column %s: auto increment requires an integer column", c.name)
+		}
+		if !inlinePrimaryKey {
+			return "", fmt.Errorf("column %s: auto increment requires a single column primary key", c.name)
+		}
+	}
+
+	parts := []string{quoteIdentifier(dialect, c.name), c.sqlType(dialect)}
+
+	if !c.nullable {
+		parts = append(parts, "NOT NULL")
+	}
+
+	if c.hasDefault {
+		literal, err := quoteLiteral(dialect, c.defaultValue)
+		if err != nil {
+			return "", fmt.Errorf("column %s: %w", c.name, err)
+		}
+		parts = append(parts, "DEFAULT "+literal)
+	}
+
+	if c.autoIncrement && dialect == DialectMySQL {
+		parts = append(parts, "AUTO_INCREMENT")
+	}
+
+	if c.unique {
+		parts = append(parts, "UNIQUE")
+	}
+
+	if inlinePrimaryKey {
+		parts = append(parts, "PRIMARY KEY")
+		if c.autoIncrement && dialect == DialectSQLite {
+			parts = append(parts, "AUTOINCREMENT")
+		}
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// ForeignKeyBuilder describes a foreign key of a TableBuilder
+type ForeignKeyBuilder struct {
+	column    string
+	refTable  string
+	refColumn string
+	onDelete  string
+	onUpdate  string
+}
+
+// References sets the referenced table and column
+func (f *ForeignKeyBuilder) References(table string, column string) *ForeignKeyBuilder {
+	f.refTable = table
+	f.refColumn = column
+	return f
+}
+
+// OnDelete sets the ON DELETE action (e.g. "CASCADE", "SET NULL")
+func (f *ForeignKeyBuilder) OnDelete(action string) *ForeignKeyBuilder {
+	f.onDelete = action
+	return f
+}
+
+// OnUpdate sets the ON UPDATE action (e.g. "CASCADE", "SET NULL")
+func (f *ForeignKeyBuilder) OnUpdate(action string) *ForeignKeyBuilder {
+	f.onUpdate = action
+	return f
+}
+
+func (f *ForeignKeyBuilder) definition(dialect string) (string, error) {
+	if f.refTable == "" || f.refColumn == "" {
+		return "", fmt.Errorf("foreign key on %s has no referenced table and column", f.column)
+	}
+
+	definition := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quoteIdentifier(dialect, f.column), quoteIdentifier(dialect, f.refTable), quoteIdentifier(dialect, f.refColumn))
+
+	if f.onDelete != "" {
+		definition += " ON DELETE " + strings.ToUpper(f.onDelete)
+	}
+
+	if f.onUpdate != "" {
+		definition += " ON UPDATE " + strings.ToUpper(f.onUpdate)
+	}
+
+	return definition, nil
+}
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"strings"
+	"testing"
+)
+
+func newUsersTableBuilder() *TableBuilder {
+	table := NewTableBuilder("users")
+	table.Integer("id").AutoIncrement()
+	table.String("email", 191).NotNull().Unique()
+	table.Text("name")
+	table.Bool("active").NotNull().Default(true)
+	table.Decimal("balance", 12, 2).Default(0)
+	table.JSON("settings")
+	table.Timestamp("created_at").NotNull().DefaultCurrentTimestamp()
+	table.Index("name")
+	return table
+}
+
+func TestTableBuilderSQL(t *testing.T) {
+	table := newUsersTableBuilder()
+
+	tests := []struct {
+		driver   string
+		expected []string
+	}{
+		{
+			driver: "sqlite",
+			expected: []string{
+				`CREATE TABLE IF NOT EXISTS "users" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "email" VARCHAR(191) NOT NULL UNIQUE, "name" TEXT, "active" BOOLEAN NOT NULL DEFAULT 1, "balance" DECIMAL(12,2) DEFAULT 0, "settings" TEXT, "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP)`,
+				`CREATE INDEX IF NOT EXISTS "idx_users_name" ON "users" ("name")`,
+			},
+		},
+		{
+			driver: "mysql",
+			expected: []string{
+				"CREATE TABLE IF NOT EXISTS `users` (`id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, `email` VARCHAR(191) NOT NULL UNIQUE, `name` TEXT, `active` TINYINT(1) NOT NULL DEFAULT 1, `balance` DECIMAL(12,2) DEFAULT 0, `settings` JSON, `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, INDEX `idx_users_name` (`name`))",
+			},
+		},
+		{
+			driver: "pgx",
+			expected: []string{
+				`CREATE TABLE IF NOT EXISTS "users" ("id" BIGSERIAL NOT NULL PRIMARY KEY, "email" VARCHAR(191) NOT NULL UNIQUE, "name" TEXT, "active" BOOLEAN NOT NULL DEFAULT TRUE, "balance" DECIMAL(12,2) DEFAULT 0, "settings" JSONB, "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)`,
+				`CREATE INDEX IF NOT EXISTS "idx_users_name" ON "users" ("name")`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		statements, err := table.SQL(tt.driver)
+		if err != nil {
+			t.Fatalf("SQL(%q) failed: %v", tt.driver, err)
+		}
+		if strings.Join(statements, ";\n") != strings.Join(tt.expected, ";\n") {
+			t.Errorf("Unexpected SQL for %s:\nexpected %q\ngot      %q", tt.driver, tt.expected, statements)
+		}
+	}
+
+	if _, err := table.SQL("oracle"); err == nil {
+		t.Errorf("Expected an error for an unsupported driver")
+	}
+}
+
+func TestTableBuilderCompositeKeyAndForeignKey(t *testing.T) {
+	table := NewTableBuilder("user_roles")
+	table.Integer("user_id").NotNull()
+	table.Integer("role_id").NotNull()
+	table.PrimaryKey("user_id", "role_id")
+	table.ForeignKey("user_id").References("users", "id").OnDelete("cascade")
+
+	statements, err := table.SQL("sqlite")
+	if err != nil {
+		t.Fatalf("SQL failed: %v", err)
+	}
+
+	expected := `CREATE TABLE IF NOT EXISTS "user_roles" ("user_id" INTEGER NOT NULL, "role_id" INTEGER NOT NULL, PRIMARY KEY ("user_id", "role_id"), FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE)`
+	if len(statements) != 1 || statements[0] != expected {
+		t.Errorf("Expected %q, got %q", expected, statements)
+	}
+
+	invalid := NewTableBuilder("invalid")
+	invalid.Text("id").AutoIncrement()
+	if _, err := invalid.SQL("sqlite"); err == nil {
+		t.Errorf("Expected an error for auto increment on a text column")
+	}
+}
+
+func TestCreateTestTableFromBuilder(t *testing.T) {
+	db, err := NewTestDB(nil)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer CloseTestDB(db)
+
+	err = CreateTestTableFromBuilder(db, newUsersTableBuilder())
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+	defer DropTestTable(db, "users")
+
+	// Creating the table a second time must not fail
+	err = CreateTestTableFromBuilder(db, newUsersTableBuilder())
+	if err != nil {
+		t.Fatalf("Failed to re-create test table: %v", err)
+	}
+
+	err = ExecuteSQLWithArgs(db, "INSERT INTO users (email, name) VALUES (?, ?)", "test@example.com", "Test User")
+	if err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	var id int
+	var active bool
+	err = db.QueryRow("SELECT id, active FROM users WHERE email = ?", "test@example.com").Scan(&id, &active)
+	if err != nil {
+		t.Fatalf("Failed to query test data: %v", err)
+	}
+	if id != 1 || !active {
+		t.Errorf("Expected id 1 and active true, got %d and %v", id, active)
+	}
+
+	err = ExecuteSQLWithArgs(db, "INSERT INTO users (email) VALUES (?)", "test@example.com")
+	if err == nil {
+		t.Errorf("Expected unique constraint violation")
+	}
+}
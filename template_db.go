@@ -0,0 +1,447 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// DBTemplateMaxAge is how long an unused SQLite template is kept
+const DBTemplateMaxAge = 7 * 24 * time.Hour
+
+// DBTemplate builds a database once, with migrations and seeds, and hands
+// every test a fast clone of it instead of re-running the setup.
+//
+// Templates are keyed by a content hash of the migration inputs (driver,
+// Migrations, Seeds and Version) and are only rebuilt when these change.
+// SQLite templates are written with VACUUM INTO to a file in
+// SQLiteTemplateDir(), so they also survive between test runs, and cloned
+// by copying that file. Templates unused for DBTemplateMaxAge are removed
+// when a new one is built, see PruneSQLiteTemplates. Postgres clones use
+// CREATE DATABASE ... TEMPLATE. MySQL clones copy every table of the
+// template schema (CREATE TABLE ... LIKE followed by INSERT ... SELECT),
+// which does not copy foreign keys.
+type DBTemplate struct {
+	// Config is the database the template is created on. For postgres and
+	// mysql, Database names the database used to create the template and
+	// clone databases. Defaults to DefaultDBConfig().
+	Config *DBConfig
+
+	// Migrations are executed in order to create the schema
+	Migrations []string
+
+	// Seeds are executed in order after the migrations
+	Seeds []string
+
+	// Setup is an optional function run after the seeds. As it cannot be
+	// hashed, change Version whenever its behaviour changes.
+	Setup func(db *sql.DB) error
+
+	// Version is included in the template key
+	Version string
+
+	mu    sync.Mutex
+	built bool
+	name  string
+}
+
+// NewDBTemplate creates a new template for the given database configuration
+// and migrations
+func NewDBTemplate(config *DBConfig, migrations ...string) *DBTemplate {
+	return &DBTemplate{
+		Config:     config,
+		Migrations: migrations,
+	}
+}
+
+func (tpl *DBTemplate) config() *DBConfig {
+	if tpl.Config == nil {
+		return DefaultDBConfig()
+	}
+	return tpl.Config
+}
+
+// Key returns the content hash of the template inputs
+func (tpl *DBTemplate) Key() string {
+	hash := sha256.New()
+
+	write := func(value string) {
+		fmt.Fprintf(hash, "%d:%s;", len(value), value)
+	}
+
+	write(normalizeDriver(tpl.config().Driver))
+	write(tpl.Version)
+
+	for _, migration := range tpl.Migrations {
+		write("migration")
+		write(migration)
+	}
+
+	for _, seed := range tpl.Seeds {
+		write("seed")
+		write(seed)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Build creates the template if it does not exist yet. It is called by
+// NewTestDB, but can also be called from TestMain to build the template
+// before any test runs.
+func (tpl *DBTemplate) Build() error {
+	tpl.mu.Lock()
+	defer tpl.mu.Unlock()
+
+	if tpl.built {
+		return nil
+	}
+
+	config := tpl.config()
+
+	var name string
+	var err error
+
+	switch normalizeDriver(config.Driver) {
+	case DialectSQLite:
+		name, err = tpl.buildSQLite(config)
+	case DialectPostgres, DialectMySQL:
+		name, err = tpl.buildServer(config)
+	default:
+		err = fmt.Errorf("unsupported database driver: %s", config.Driver)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to build template database: %w", err)
+	}
+
+	tpl.name = name
+	tpl.built = true
+	return nil
+}
+
+// NewTestDB returns a clone of the template which is dropped when the
+// test finishes
+func (tpl *DBTemplate) NewTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	if err := tpl.Build(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	config := tpl.config()
+
+	switch normalizeDriver(config.Driver) {
+	case DialectSQLite:
+		path := filepath.Join(t.TempDir(), "test.db")
+		if err := copyFile(tpl.name, path); err != nil {
+			t.Fatalf("failed to clone template database: %v", err)
+		}
+
+		cloneConfig := configWithDatabase(config, path)
+		cloneConfig.SQLiteFile = true
+		return NewTestDBT(t, cloneConfig)
+	}
+
+	cloneName := "test_" + randomHex(8)
+	if err := tpl.cloneServer(config, cloneName); err != nil {
+		t.Fatalf("failed to clone template database: %v", err)
+	}
+
+	db, err := NewTestDB(configWithDatabase(config, cloneName))
+	if err != nil {
+		dropServerDatabase(config, cloneName)
+		t.Fatalf("failed to open template clone: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := CloseTestDB(db); err != nil {
+			t.Errorf("failed to close test database: %v", err)
+		}
+		if err := dropServerDatabase(config, cloneName); err != nil {
+			t.Errorf("failed to drop template clone %s: %v", cloneName, err)
+		}
+	})
+
+	return db
+}
+
+// setup runs the migrations, seeds and setup function on a database
+func (tpl *DBTemplate) setup(db *sql.DB) error {
+	for _, statement := range append(append([]string{}, tpl.Migrations...), tpl.Seeds...) {
+		if err := ExecuteSQL(db, statement); err != nil {
+			return fmt.Errorf("failed to execute %q: %w", statement, err)
+		}
+	}
+
+	if tpl.Setup != nil {
+		return tpl.Setup(db)
+	}
+
+	return nil
+}
+
+// SQLiteTemplateDir returns the directory SQLite templates are kept in,
+// in the user cache directory (or the system temporary directory if there
+// is none)
+func SQLiteTemplateDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "dracory-test", "templates")
+}
+
+// PruneSQLiteTemplates removes the SQLite templates not used for maxAge,
+// or all of them if maxAge is 0, e.g. from TestMain or a make target
+func PruneSQLiteTemplates(maxAge time.Duration) error {
+	entries, err := os.ReadDir(SQLiteTemplateDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".db") && !strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		if maxAge > 0 && time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(SQLiteTemplateDir(), entry.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (tpl *DBTemplate) buildSQLite(config *DBConfig) (string, error) {
+	dir := SQLiteTemplateDir()
+	path := filepath.Join(dir, tpl.Key()+".db")
+
+	if _, err := os.Stat(path); err == nil {
+		// Mark the template as used, so it is not pruned
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return path, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	// Templates of old migrations are never used again
+	if err := PruneSQLiteTemplates(DBTemplateMaxAge); err != nil {
+		return "", fmt.Errorf("failed to prune templates: %w", err)
+	}
+
+	buildConfig := configWithDatabase(config, "file:template_"+randomHex(8)+"?mode=memory&cache=shared")
+	buildConfig.SQLiteFile = false
+
+	db, err := NewTestDB(buildConfig)
+	if err != nil {
+		return "", err
+	}
+	defer CloseTestDB(db)
+
+	if err := tpl.setup(db); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary name first, so concurrent test binaries never
+	// see a half written template
+	tmpPath := path + "." + randomHex(8) + ".tmp"
+	if _, err := db.Exec("VACUUM INTO ?", tmpPath); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	return path, nil
+}
+
+func (tpl *DBTemplate) buildServer(config *DBConfig) (string, error) {
+	name := "tpl_" + tpl.Key()[:32]
+
+	admin, err := NewTestDB(config)
+	if err != nil {
+		return "", err
+	}
+	defer CloseTestDB(admin)
+
+	exists, err := serverDatabaseExists(admin, config, name)
+	if err != nil || exists {
+		return name, err
+	}
+
+	// Build under a temporary name and rename once complete, so a failed
+	// or concurrent build never leaves a half built template behind
+	buildName := name + "_" + randomHex(4)
+	dialect := DialectForDB(admin)
+	if err := ExecuteSQL(admin, "CREATE DATABASE "+dialect.QuoteIdentifier(buildName)); err != nil {
+		return "", err
+	}
+
+	db, err := NewTestDB(configWithDatabase(config, buildName))
+	if err != nil {
+		dropServerDatabase(config, buildName)
+		return "", err
+	}
+
+	err = tpl.setup(db)
+	CloseTestDB(db)
+	if err != nil {
+		dropServerDatabase(config, buildName)
+		return "", err
+	}
+
+	if dialect.Name() == DialectPostgres {
+		err = ExecuteSQL(admin, fmt.Sprintf("ALTER DATABASE %s RENAME TO %s",
+			dialect.QuoteIdentifier(buildName), dialect.QuoteIdentifier(name)))
+	} else {
+		// MySQL cannot rename databases, so the schema is copied instead
+		err = copyMySQLSchema(admin, buildName, name)
+	}
+
+	if err != nil {
+		dropServerDatabase(config, buildName)
+		if exists, _ := serverDatabaseExists(admin, config, name); exists {
+			// Built concurrently by another test binary
+			return name, nil
+		}
+		return "", err
+	}
+
+	if dialect.Name() == DialectMySQL {
+		dropServerDatabase(config, buildName)
+	}
+
+	return name, nil
+}
+
+func (tpl *DBTemplate) cloneServer(config *DBConfig, cloneName string) error {
+	admin, err := NewTestDB(config)
+	if err != nil {
+		return err
+	}
+	defer CloseTestDB(admin)
+
+	dialect := DialectForDB(admin)
+
+	if dialect.Name() == DialectPostgres {
+		return ExecuteSQL(admin, fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s",
+			dialect.QuoteIdentifier(cloneName), dialect.QuoteIdentifier(tpl.name)))
+	}
+
+	if err := copyMySQLSchema(admin, tpl.name, cloneName); err != nil {
+		dropServerDatabase(config, cloneName)
+		return err
+	}
+
+	return nil
+}
+
+// copyMySQLSchema creates the target schema and copies every table, with its
+// rows, from the source schema
+func copyMySQLSchema(db *sql.DB, source string, target string) error {
+	dialect := DialectForDB(db)
+
+	if err := ExecuteSQL(db, "CREATE DATABASE "+dialect.QuoteIdentifier(target)); err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = ? AND table_type = 'BASE TABLE'", source)
+	if err != nil {
+		return err
+	}
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		sourceTable := dialect.QuoteIdentifier(source) + "." + dialect.QuoteIdentifier(table)
+		targetTable := dialect.QuoteIdentifier(target) + "." + dialect.QuoteIdentifier(table)
+
+		if err := ExecuteSQL(db, fmt.Sprintf("CREATE TABLE %s LIKE %s", targetTable, sourceTable)); err != nil {
+			return err
+		}
+
+		if err := ExecuteSQL(db, fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", targetTable, sourceTable)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func serverDatabaseExists(db *sql.DB, config *DBConfig, name string) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = ?"
+	if normalizeDriver(config.Driver) == DialectPostgres {
+		query = "SELECT COUNT(*) FROM pg_database WHERE datname = ?"
+	}
+
+	query, args, err := RebindSQL(db, query, name)
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	if err := db.QueryRow(query, args...).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func dropServerDatabase(config *DBConfig, name string) error {
+	admin, err := NewTestDB(config)
+	if err != nil {
+		return err
+	}
+	defer CloseTestDB(admin)
+
+	return ExecuteSQL(admin, "DROP DATABASE IF EXISTS "+DialectForDB(admin).QuoteIdentifier(name))
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
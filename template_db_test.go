@@ -0,0 +1,127 @@
+package test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTempTemplateDir points SQLiteTemplateDir at a temporary directory, so
+// tests do not write to the user cache directory
+func useTempTemplateDir(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	t.Setenv("LocalAppData", cache)
+}
+
+func TestDBTemplateKey(t *testing.T) {
+	tpl1 := NewDBTemplate(nil, "CREATE TABLE a (id INTEGER)")
+	tpl2 := NewDBTemplate(nil, "CREATE TABLE a (id INTEGER)")
+	tpl3 := NewDBTemplate(nil, "CREATE TABLE a (id INTEGER, name TEXT)")
+
+	if tpl1.Key() != tpl2.Key() {
+		t.Errorf("Expected equal keys for equal inputs")
+	}
+	if tpl1.Key() == tpl3.Key() {
+		t.Errorf("Expected different keys for different migrations")
+	}
+
+	tpl2.Version = "2"
+	if tpl1.Key() == tpl2.Key() {
+		t.Errorf("Expected different keys for different versions")
+	}
+}
+
+func TestDBTemplateSQLiteClones(t *testing.T) {
+	useTempTemplateDir(t)
+
+	setupRuns := 0
+	tpl := NewDBTemplate(nil,
+		"CREATE TABLE template_users (id INTEGER PRIMARY KEY, name TEXT)",
+	)
+	tpl.Seeds = []string{"INSERT INTO template_users (name) VALUES ('seeded')"}
+	tpl.Version = randomHex(8) // force a fresh build for this test run
+	tpl.Setup = func(db *sql.DB) error {
+		setupRuns++
+		return nil
+	}
+
+	if err := tpl.Build(); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	defer os.Remove(tpl.name)
+
+	db1 := tpl.NewTestDB(t)
+	db2 := tpl.NewTestDB(t)
+
+	if setupRuns != 1 {
+		t.Errorf("Expected setup to run once, ran %d times", setupRuns)
+	}
+
+	if err := ExecuteSQL(db1, "INSERT INTO template_users (name) VALUES ('only in db1')"); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	var count1, count2 int
+	if err := db1.QueryRow("SELECT COUNT(*) FROM template_users").Scan(&count1); err != nil {
+		t.Fatalf("Failed to count: %v", err)
+	}
+	if err := db2.QueryRow("SELECT COUNT(*) FROM template_users").Scan(&count2); err != nil {
+		t.Fatalf("Failed to count: %v", err)
+	}
+
+	if count1 != 2 || count2 != 1 {
+		t.Errorf("Expected clones to be independent (2 and 1 rows), got %d and %d", count1, count2)
+	}
+
+	// A new template with the same inputs reuses the existing file
+	again := NewDBTemplate(nil, tpl.Migrations...)
+	again.Seeds = tpl.Seeds
+	again.Version = tpl.Version
+	again.Setup = tpl.Setup
+	if err := again.Build(); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if setupRuns != 1 {
+		t.Errorf("Expected the template to be reused, setup ran %d times", setupRuns)
+	}
+}
+
+func TestPruneSQLiteTemplates(t *testing.T) {
+	useTempTemplateDir(t)
+
+	stale := filepath.Join(SQLiteTemplateDir(), "stale.db")
+	if err := os.MkdirAll(SQLiteTemplateDir(), 0o755); err != nil {
+		t.Fatalf("Failed to create the template directory: %v", err)
+	}
+	if err := os.WriteFile(stale, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write a stale template: %v", err)
+	}
+	old := time.Now().Add(-2 * DBTemplateMaxAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("Failed to age the stale template: %v", err)
+	}
+
+	// Building a new template prunes the stale one
+	tpl := NewDBTemplate(nil, "CREATE TABLE pruned (id INTEGER)")
+	if err := tpl.Build(); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale template to be removed, got %v", err)
+	}
+	if _, err := os.Stat(tpl.name); err != nil {
+		t.Errorf("Expected the new template to be kept, got %v", err)
+	}
+
+	if err := PruneSQLiteTemplates(0); err != nil {
+		t.Fatalf("PruneSQLiteTemplates failed: %v", err)
+	}
+	if _, err := os.Stat(tpl.name); !os.IsNotExist(err) {
+		t.Errorf("Expected every template to be removed, got %v", err)
+	}
+}
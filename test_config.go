@@ -156,3 +156,46 @@ func CleanupTestEnvironment(config *TestConfig) {
 		os.Unsetenv(key)
 	}
 }
+
+// envVars returns the environment variables SetupTestEnvironment sets for
+// the configuration, including AdditionalEnvVars
+func (config *TestConfig) envVars() map[string]string {
+	vars := map[string]string{
+		// Application settings
+		"APP_NAME": config.AppName,
+		"APP_URL":  config.AppURL,
+		"APP_ENV":  config.AppEnv,
+
+		// Database settings
+		"DB_DRIVER":   config.DbDriver,
+		"DB_HOST":     config.DbHost,
+		"DB_PORT":     config.DbPort,
+		"DB_DATABASE": config.DbDatabase,
+		"DB_USERNAME": config.DbUsername,
+		"DB_PASSWORD": config.DbPassword,
+
+		// Server settings
+		"SERVER_HOST": config.ServerHost,
+		"SERVER_PORT": config.ServerPort,
+
+		// Mail settings
+		"MAIL_DRIVER":        config.MailDriver,
+		"MAIL_HOST":          config.MailHost,
+		"MAIL_PORT":          config.MailPort,
+		"MAIL_USERNAME":      config.MailUsername,
+		"MAIL_PASSWORD":      config.MailPassword,
+		"EMAIL_FROM_ADDRESS": config.EmailFrom,
+		"EMAIL_FROM_NAME":    config.EmailName,
+
+		// Security settings
+		"ENV_ENCRYPTION_KEY": config.EnvEncryptionKey,
+		"VAULT_KEY":          config.VaultKey,
+	}
+
+	// Add any additional environment variables
+	for key, value := range config.AdditionalEnvVars {
+		vars[key] = value
+	}
+
+	return vars
+}
@@ -1,8 +1,15 @@
 package test
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
 )
 
 // DBConfig contains configuration for test database
@@ -13,8 +20,48 @@ type DBConfig struct {
 	Database string
 	Username string
 	Password string
+
+	// DSN, if set, is passed to the driver as is instead of building one
+	// from the fields above with the DSN builder registered for the driver
+	DSN string
+
+	// Options are extra driver parameters added to the built DSN, such as
+	// charset or loc for mysql and sslmode, search_path or timezone for
+	// postgres. They override the defaults (parseTime=true for mysql,
+	// sslmode=disable for postgres).
+	Options map[string]string
+
+	// SQLiteFile creates the SQLite database as a file instead of in memory.
+	// With NewTestDBT the file is created in t.TempDir() and kept for
+	// inspection if the test fails; with NewTestDB, Database must be a path.
+	SQLiteFile bool
+
+	// DetectLeaks wraps the driver to track every Rows, Stmt and Tx opened
+	// through the database. CloseTestDB then returns a *LeakError listing
+	// the ones left open, with the stack trace where each was created.
+	DetectLeaks bool
+
+	// Pragmas are applied to every SQLite connection (e.g. "journal_mode":
+	// "WAL"). For file backed databases they override DefaultSQLitePragmas.
+	Pragmas map[string]string
+
+	// CheckContexts wraps the driver so VerifyContextCancellation can check
+	// the context every query runs with
+	CheckContexts bool
 }
 
+var (
+	// ErrDriverNotRegistered is wrapped by the error NewTestDB returns when
+	// the configured driver has not been registered with database/sql
+	ErrDriverNotRegistered = errors.New("driver not registered")
+
+	// ErrDatabaseUnavailable is wrapped by the error NewTestDB returns when
+	// the database server cannot be reached: the connection is refused, the
+	// host does not resolve or the connection times out. Authentication and
+	// permission errors are not wrapped.
+	ErrDatabaseUnavailable = errors.New("database unavailable")
+)
+
 // DefaultDBConfig returns a default SQLite in-memory database configuration.
 // To use the default SQLite driver, ensure you import a compatible driver
 // package (for example, via a blank import in your test setup) before calling
@@ -38,21 +85,12 @@ func NewTestDB(config *DBConfig) (*sql.DB, error) {
 	}
 
 	if !driverRegistered(config.Driver) {
-		return nil, fmt.Errorf("database driver %q is not registered. Import the driver package (e.g. _ \"modernc.org/sqlite\") or configure a different driver before creating the test database", config.Driver)
+		return nil, fmt.Errorf("database driver %q is not registered. Import the driver package (e.g. _ \"modernc.org/sqlite\") or configure a different driver before creating the test database: %w", config.Driver, ErrDriverNotRegistered)
 	}
 
-	var dsn string
-	switch config.Driver {
-	case "sqlite":
-		dsn = config.Database
-	case "mysql":
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-			config.Username, config.Password, config.Host, config.Port, config.Database)
-	case "postgres":
-		dsn = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-			config.Host, config.Port, config.Username, config.Password, config.Database)
-	default:
-		return nil, fmt.Errorf("unsupported database driver: %s", config.Driver)
+	dsn, err := BuildDSN(config)
+	if err != nil {
+		return nil, err
 	}
 
 	db, err := sql.Open(config.Driver, dsn)
@@ -60,15 +98,94 @@ func NewTestDB(config *DBConfig) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
+	var tracker *leakTracker
+	if config.DetectLeaks {
+		tracker = newLeakTracker()
+	}
+
+	var observers *queryObservers
+	if config.CheckContexts {
+		observers = &queryObservers{}
+	}
+
+	if tracker != nil || observers != nil {
+		trackedDB, err := openTrackedDB(db.Driver(), dsn, driverHooks{tracker: tracker, observers: observers})
+		db.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database connection: %w", err)
+		}
+		db = trackedDB
+	}
+
 	// Verify the connection
 	if err := db.Ping(); err != nil {
 		db.Close()
+		if isUnreachable(err) {
+			return nil, fmt.Errorf("failed to ping database: %w: %w", ErrDatabaseUnavailable, err)
+		}
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	dbDrivers.Store(db, config.Driver)
+	if tracker != nil {
+		dbTrackers.Store(db, tracker)
+	}
+	if observers != nil {
+		dbObservers.Store(db, observers)
+	}
+
 	return db, nil
 }
 
+// NewTestDBT creates a new test database connection which is closed when
+// the test finishes, failing the test if the database cannot be created.
+// With SQLiteFile set, the database file is created in t.TempDir() and its
+// path logged; if the test fails, the file is kept for post-mortem inspection.
+func NewTestDBT(t testing.TB, config *DBConfig) *sql.DB {
+	t.Helper()
+
+	if config == nil {
+		config = DefaultDBConfig()
+	}
+
+	path := ""
+	if config.SQLiteFile {
+		if isSQLiteMemory(config.Database) {
+			config = configWithDatabase(config, filepath.Join(t.TempDir(), "test.db"))
+		}
+		path = config.Database
+		t.Logf("sqlite test database: %s", path)
+	}
+
+	db, err := NewTestDB(config)
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := CloseTestDB(db); err != nil {
+			t.Errorf("failed to close test database: %v", err)
+		}
+
+		if path == "" || !t.Failed() {
+			return
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			return
+		}
+
+		kept, err := keepSQLiteFile(path)
+		if err != nil {
+			t.Logf("failed to keep sqlite test database %s: %v", path, err)
+			return
+		}
+		t.Logf("test failed, sqlite test database kept at: %s", kept)
+	})
+
+	return db
+}
+
 func driverRegistered(name string) bool {
 	for _, driver := range sql.Drivers() {
 		if driver == name {
@@ -78,12 +195,23 @@ func driverRegistered(name string) bool {
 	return false
 }
 
-// CloseTestDB safely closes a test database connection
+// CloseTestDB safely closes a test database connection. If the database
+// was opened with DetectLeaks, a *LeakError is returned when rows,
+// statements, transactions or connections were left open.
 func CloseTestDB(db *sql.DB) error {
-	if db != nil {
-		return db.Close()
+	if db == nil {
+		return nil
 	}
-	return nil
+
+	dbDrivers.Delete(db)
+	dbObservers.Delete(db)
+
+	var leakErr error
+	if tracker, ok := dbTrackers.LoadAndDelete(db); ok {
+		leakErr = tracker.(*leakTracker).check(db)
+	}
+
+	return errors.Join(leakErr, db.Close())
 }
 
 // ExecuteSQL executes a SQL statement on the database
@@ -92,9 +220,16 @@ func ExecuteSQL(db *sql.DB, sql string) error {
 	return err
 }
 
-// ExecuteSQLWithArgs executes a SQL statement with arguments on the database
+// ExecuteSQLWithArgs executes a SQL statement with arguments on the database.
+// Placeholders ("?", "$N", ":name" or "@name") are rewritten for the driver
+// the database was opened with, see Dialect.Rebind.
 func ExecuteSQLWithArgs(db *sql.DB, sql string, args ...interface{}) error {
-	_, err := db.Exec(sql, args...)
+	query, boundArgs, err := RebindSQL(db, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(query, boundArgs...)
 	return err
 }
 
@@ -104,8 +239,40 @@ func CreateTestTable(db *sql.DB, tableName string, schema string) error {
 	return ExecuteSQL(db, createTableSQL)
 }
 
+// CreateTestTableFromBuilder creates the table described by a TableBuilder,
+// rendered for the driver the database was opened with
+func CreateTestTableFromBuilder(db *sql.DB, table *TableBuilder) error {
+	statements, err := table.SQL(driverForDB(db))
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if err := ExecuteSQL(db, statement); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", table.Name(), err)
+		}
+	}
+	return nil
+}
+
 // DropTestTable drops a test table from the database
 func DropTestTable(db *sql.DB, tableName string) error {
 	dropTableSQL := fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName)
 	return ExecuteSQL(db, dropTableSQL)
 }
+
+// isUnreachable reports whether err means the database server could not be
+// reached (connection refused, DNS failure or timeout)
+func isUnreachable(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,346 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+)
+
+// driverHooks are the optional features of the tracked driver
+type driverHooks struct {
+	// tracker is told about every Rows, Stmt and Tx opened and closed
+	tracker *leakTracker
+
+	// observers are told about every query executed, with its context
+	observers *queryObservers
+}
+
+// openTrackedDB opens a database wrapping the driver with the hooks. The
+// wrapper is transparent to the code under test: optional driver interfaces
+// are forwarded when the underlying driver implements them.
+func openTrackedDB(d driver.Driver, dsn string, hooks driverHooks) (*sql.DB, error) {
+	var connector driver.Connector = dsnConnector{driver: d, dsn: dsn}
+
+	if driverContext, ok := d.(driver.DriverContext); ok {
+		c, err := driverContext.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		connector = c
+	}
+
+	return sql.OpenDB(&trackedConnector{connector: connector, hooks: hooks}), nil
+}
+
+// dsnConnector is a driver.Connector for drivers that do not implement
+// driver.DriverContext
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type trackedConnector struct {
+	connector driver.Connector
+	hooks     driverHooks
+}
+
+func (c *trackedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &trackedConn{conn: conn, hooks: c.hooks}, nil
+}
+
+func (c *trackedConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+type trackedConn struct {
+	conn  driver.Conn
+	hooks driverHooks
+}
+
+func (c *trackedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *trackedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := c.hooks.tracker.track(leakKindStmt, query)
+	return &trackedStmt{stmt: stmt, tracker: c.hooks.tracker, observers: c.hooks.observers, id: id, query: query}, nil
+}
+
+func (c *trackedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *trackedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *trackedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.conn.Begin()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := c.hooks.tracker.track(leakKindTx, "")
+	return &trackedTx{tx: tx, tracker: c.hooks.tracker, id: id}, nil
+}
+
+func (c *trackedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	done := c.hooks.observers.start(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	done(err)
+
+	return result, err
+}
+
+func (c *trackedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	done := c.hooks.observers.start(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	done(err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := c.hooks.tracker.track(leakKindRows, query)
+	return &trackedRows{rows: rows, tracker: c.hooks.tracker, id: id}, nil
+}
+
+func (c *trackedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *trackedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *trackedConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *trackedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type trackedStmt struct {
+	stmt      driver.Stmt
+	tracker   *leakTracker
+	observers *queryObservers
+	id        uint64
+	query     string
+}
+
+func (s *trackedStmt) Close() error {
+	s.tracker.release(s.id)
+	return s.stmt.Close()
+}
+
+func (s *trackedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *trackedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *trackedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *trackedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var result driver.Result
+	var err error
+
+	done := s.observers.start(ctx, s.query)
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.stmt.Exec(namedValuesToValues(args))
+	}
+	done(err)
+
+	return result, err
+}
+
+func (s *trackedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	var err error
+
+	done := s.observers.start(ctx, s.query)
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.stmt.Query(namedValuesToValues(args))
+	}
+	done(err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := s.tracker.track(leakKindRows, s.query)
+	return &trackedRows{rows: rows, tracker: s.tracker, id: id}, nil
+}
+
+func (s *trackedStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type trackedTx struct {
+	tx      driver.Tx
+	tracker *leakTracker
+	id      uint64
+}
+
+func (t *trackedTx) Commit() error {
+	t.tracker.release(t.id)
+	return t.tx.Commit()
+}
+
+func (t *trackedTx) Rollback() error {
+	t.tracker.release(t.id)
+	return t.tx.Rollback()
+}
+
+type trackedRows struct {
+	rows    driver.Rows
+	tracker *leakTracker
+	id      uint64
+}
+
+func (r *trackedRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *trackedRows) Close() error {
+	r.tracker.release(r.id)
+	return r.rows.Close()
+}
+
+func (r *trackedRows) Next(dest []driver.Value) error {
+	return r.rows.Next(dest)
+}
+
+func (r *trackedRows) HasNextResultSet() bool {
+	if rows, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return rows.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *trackedRows) NextResultSet() error {
+	if rows, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return rows.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *trackedRows) ColumnTypeScanType(index int) reflect.Type {
+	if rows, ok := r.rows.(driver.RowsColumnTypeScanType); ok {
+		return rows.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func (r *trackedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if rows, ok := r.rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return rows.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *trackedRows) ColumnTypeLength(index int) (int64, bool) {
+	if rows, ok := r.rows.(driver.RowsColumnTypeLength); ok {
+		return rows.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *trackedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if rows, ok := r.rows.(driver.RowsColumnTypeNullable); ok {
+		return rows.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *trackedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if rows, ok := r.rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return rows.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+func valuesToNamedValues(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return values
+}